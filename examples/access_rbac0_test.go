@@ -1,11 +1,25 @@
 package examples
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gromitlee/access"
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/decisionlog"
+	"github.com/gromitlee/access/pkg/errs"
 	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/policy"
+	"github.com/gromitlee/access/pkg/watcher"
 	"gorm.io/gorm"
 )
 
@@ -14,12 +28,18 @@ const (
 	roleTenantAdmin perm.Role = 2
 	roleTenantUser  perm.Role = 3
 	roleSysUser     perm.Role = 4
+	roleEditor      perm.Role = 5
+
+	domainTenant1 perm.Domain = "tenant_1"
+	domainTenant2 perm.Domain = "tenant_2"
 
 	objSystem  = "obj_system"
 	objTenant  = "obj_tenant"
 	objProject = "obj_project"
 
 	act = "act"
+
+	user1 int64 = 1001
 )
 
 func TestAccessRBAC0Controller(t *testing.T) {
@@ -30,17 +50,86 @@ func TestAccessRBAC0Controller(t *testing.T) {
 	if err := createRolesAndAddPerms(db); err != nil {
 		t.Fatal(err)
 	}
+	if err := checkUserRoles(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSessions(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoleInheritance(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSSD(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDSD(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDomains(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWildcards(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDenyRules(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPermExpiry(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPermConds(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCache(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWatcher(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDecisions(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExplain(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAuditLogs(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDecisionLog(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTransaction(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkErrors(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoleQuery(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRolePages(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPolicyFiles(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPolicyPlan(db); err != nil {
+		t.Fatal(err)
+	}
 	if err := checkTenantAdminPerms(db); err != nil {
 		t.Fatal(err)
 	}
 	if err := deleteRoles(db); err != nil {
 		t.Fatal(err)
 	}
+	if err := checkLifecycle(); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func createRolesAndAddPerms(db *gorm.DB) error {
 	// role: sys_admin
-	if _, err := access.RBAC0CreateRole(db, roleSysAdmin, 0, "role_sys_admin", "", true); err != nil {
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleSysAdmin, 0, "role_sys_admin", "", true); err != nil {
 		return err
 	}
 	if sysAdmin, err := access.RBAC0GetRoleInfo(db, roleSysAdmin); err != nil {
@@ -49,7 +138,7 @@ func createRolesAndAddPerms(db *gorm.DB) error {
 		return errors.New("unexpected role")
 	}
 	// role: tenant_admin
-	if _, err := access.RBAC0CreateRole(db, roleTenantAdmin, 0, "role_tenant_admin", "", false); err != nil {
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleTenantAdmin, 0, "role_tenant_admin", "", false); err != nil {
 		return err
 	}
 	if tenantAdmin, err := access.RBAC0GetRoleInfo(db, roleTenantAdmin); err != nil {
@@ -58,7 +147,7 @@ func createRolesAndAddPerms(db *gorm.DB) error {
 		return errors.New("unexpected role")
 	}
 	// role: tenant_user
-	if _, err := access.RBAC0CreateRole(db, roleTenantUser, 0, "role_tenant_user", "", false); err != nil {
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleTenantUser, 0, "role_tenant_user", "", false); err != nil {
 		return err
 	}
 	if tenantUser, err := access.RBAC0GetRoleInfo(db, roleTenantUser); err != nil {
@@ -67,7 +156,7 @@ func createRolesAndAddPerms(db *gorm.DB) error {
 		return errors.New("unexpected role")
 	}
 	// role: sys_user
-	if _, err := access.RBAC0CreateRole(db, roleSysUser, 0, "role_sys_user", "", false); err != nil {
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleSysUser, 0, "role_sys_user", "", false); err != nil {
 		return err
 	}
 	if sysUser, err := access.RBAC0GetRoleInfo(db, roleSysUser); err != nil {
@@ -107,104 +196,1592 @@ func createRolesAndAddPerms(db *gorm.DB) error {
 	return nil
 }
 
-func checkTenantAdminPerms(db *gorm.DB) error {
-	// list infos
-	if _, count, err := access.RBAC0ListRoleInfo(db, "tenant", 1, 0, 10, -1); err != nil {
+func checkUserRoles(db *gorm.DB) error {
+	// assign roles
+	if err := access.RBAC0AssignUserRoles(db, user1, []perm.Role{roleTenantUser, roleTenantUser}); err != nil {
 		return err
-	} else if count != 2 {
-		return errors.New("unexpected count")
+	}
+	if roles, err := access.RBAC0ListUserRoles(db, user1); err != nil {
+		return err
+	} else if len(roles) != 1 || roles[0] != roleTenantUser {
+		return errors.New("unexpected roles")
 	}
 
-	// list perms
-	if _, count, err := access.RBAC0ListRolePerms(db, "tenant", 1, 0, 10, -1); err != nil {
+	// check user perms
+	if ok, err := access.RBAC0CheckUserPerm(db, perm.GlobalDomain, user1, objProject, act); err != nil {
 		return err
-	} else if count != 2 {
-		return errors.New("unexpected count")
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, err := access.RBAC0CheckUserPerm(db, perm.GlobalDomain, user1, objTenant, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
 	}
 
-	// check perms
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objSystem, act); err != nil {
+	// assign & deassign roles
+	if err := access.RBAC0AssignUserRoles(db, user1, []perm.Role{roleTenantAdmin}); err != nil {
+		return err
+	}
+	if users, err := access.RBAC0ListRoleUsers(db, roleTenantAdmin); err != nil {
+		return err
+	} else if len(users) != 1 || users[0] != user1 {
+		return errors.New("unexpected users")
+	}
+	if ok, err := access.RBAC0CheckUserPerm(db, perm.GlobalDomain, user1, objTenant, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0DeassignUserRoles(db, user1, []perm.Role{roleTenantAdmin}); err != nil {
+		return err
+	}
+	if ok, err := access.RBAC0CheckUserPerm(db, perm.GlobalDomain, user1, objTenant, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+
+	return nil
+}
+
+func checkSessions(db *gorm.DB) error {
+	// least privilege by default
+	session, err := access.RBAC0CreateSession(db, perm.GlobalDomain, user1)
+	if err != nil {
+		return err
+	}
+	if ok, err := access.RBAC0CheckSessionPerm(db, session, objProject, act); err != nil {
 		return err
 	} else if ok {
 		return errors.New("unexpected permission")
 	}
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objTenant, act); err != nil {
+
+	// add & drop active role
+	if err := access.RBAC0AddActiveRole(db, session, roleTenantUser); err != nil {
+		return err
+	}
+	if err := access.RBAC0AddActiveRole(db, session, roleTenantAdmin); err == nil {
+		return errors.New("unexpected active role")
+	}
+	if ok, err := access.RBAC0CheckSessionPerm(db, session, objProject, act); err != nil {
 		return err
 	} else if !ok {
 		return errors.New("no permission")
 	}
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objProject, act); err != nil {
+	if err := access.RBAC0DropActiveRole(db, session, roleTenantUser); err != nil {
+		return err
+	}
+	if ok, err := access.RBAC0CheckSessionPerm(db, session, objProject, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+
+	// delete session
+	if err := access.RBAC0DeleteSession(db, session); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0ListSessionRoles(db, session); err != nil {
+		if !errors.Is(err, errs.ErrSessionNotFound) {
+			return err
+		}
+	} else {
+		return errors.New("unexpected session")
+	}
+
+	return nil
+}
+
+func checkRoleInheritance(db *gorm.DB) error {
+	// sys_user inherits tenant_user
+	if err := access.RBAC0AddInheritance(db, roleSysUser, roleTenantUser); err != nil {
+		return err
+	}
+	if err := access.RBAC0AddInheritance(db, roleTenantUser, roleSysUser); err == nil {
+		return errors.New("unexpected inheritance cycle")
+	}
+	if roles, err := access.RBAC0ListAncestors(db, roleTenantUser); err != nil {
+		return err
+	} else if len(roles) != 1 || roles[0] != roleSysUser {
+		return errors.New("unexpected ancestors")
+	}
+	if roles, err := access.RBAC0ListDescendants(db, roleSysUser); err != nil {
+		return err
+	} else if len(roles) != 1 || roles[0] != roleTenantUser {
+		return errors.New("unexpected descendants")
+	}
+
+	// check inherited perms
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject, act); err != nil {
 		return err
 	} else if !ok {
 		return errors.New("no permission")
 	}
+	if sysUser, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(sysUser.Perms) != 0 || len(sysUser.InheritedPerms) != 1 {
+		return errors.New("unexpected permission")
+	}
 
-	// enable & disable role
-	if err := access.RBAC0DisableRole(db, roleTenantAdmin); err != nil {
+	// delete inheritance
+	if err := access.RBAC0DeleteInheritance(db, roleSysUser, roleTenantUser); err != nil {
 		return err
 	}
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objTenant, act); err != nil {
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject, act); err != nil {
 		return err
 	} else if ok {
+		return errors.New("unexpected permission")
+	}
+
+	// inheritance deeper than 10 levels is effective in both controllers
+	const roleChain perm.Role = 60
+	const chainLen = 12
+	for i := perm.Role(0); i < chainLen; i++ {
+		var perms []perm.Perm
+		if i == chainLen-1 {
+			perms = append(perms, perm.Perm{Obj: objProject + "/chain", Act: act})
+		}
+		if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleChain+i, 0, fmt.Sprintf("role_chain_%d", i), "", false, perms...); err != nil {
+			return err
+		}
+		if i > 0 {
+			if err := access.RBAC0AddInheritance(db, roleChain+i-1, roleChain+i); err != nil {
+				return err
+			}
+		}
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleChain, objProject+"/chain", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("deep inherited permission not effective")
+	}
+	if roles, err := access.RBAC0ListDescendants(db, roleChain); err != nil {
+		return err
+	} else if len(roles) != chainLen-1 {
+		return fmt.Errorf("unexpected descendants %v", roles)
+	}
+	for i := perm.Role(0); i < chainLen; i++ {
+		if err := access.RBAC0DeleteRole(db, roleChain+i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkSSD(db *gorm.DB) error {
+	// tenant_user & sys_user are mutually exclusive
+	if err := access.RBAC0CreateSSDSet(db, "ssd_user", []perm.Role{roleTenantUser, roleSysUser}, 2); err != nil {
+		return err
+	}
+	if sets, err := access.RBAC0ListSSDSets(db); err != nil {
+		return err
+	} else if len(sets) != 1 || len(sets[0].Roles) != 2 {
+		return errors.New("unexpected ssd sets")
+	}
+
+	// user1 has been assigned tenant_user
+	var violation *perm.SSDViolationError
+	if err := access.RBAC0AssignUserRoles(db, user1, []perm.Role{roleSysUser}); !errors.As(err, &violation) {
+		return errors.New("unexpected ssd violation")
+	} else if violation.Set != "ssd_user" || len(violation.Roles) != 2 {
+		return errors.New("unexpected ssd violation")
+	}
+	if err := access.RBAC0AddInheritance(db, roleSysUser, roleTenantUser); !errors.Is(err, errs.ErrSSDViolation) {
+		return errors.New("unexpected ssd violation")
+	}
+	if roles, err := access.RBAC0ListUserRoles(db, user1); err != nil {
+		return err
+	} else if len(roles) != 1 {
+		return errors.New("unexpected roles")
+	}
+
+	// delete ssd set
+	if err := access.RBAC0DeleteSSDSet(db, "ssd_user"); err != nil {
+		return err
+	}
+	if err := access.RBAC0AssignUserRoles(db, user1, []perm.Role{roleSysUser}); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeassignUserRoles(db, user1, []perm.Role{roleSysUser}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkDSD(db *gorm.DB) error {
+	// user1 may hold tenant_user & sys_user, but must not activate both
+	if err := access.RBAC0AssignUserRoles(db, user1, []perm.Role{roleSysUser}); err != nil {
+		return err
+	}
+	if err := access.RBAC0CreateDSDSet(db, "dsd_user", []perm.Role{roleTenantUser, roleSysUser}, 2); err != nil {
+		return err
+	}
+	session, err := access.RBAC0CreateSession(db, perm.GlobalDomain, user1, roleTenantUser)
+	if err != nil {
+		return err
+	}
+	if err := access.RBAC0AddActiveRole(db, session, roleSysUser); !errors.Is(err, errs.ErrDSDViolation) {
+		return errors.New("unexpected dsd violation")
+	}
+	if _, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleTenantUser, roleSysUser}, objProject, act); !errors.Is(err, errs.ErrDSDViolation) {
+		return errors.New("unexpected dsd violation")
+	}
+	if ok, err := access.RBAC0CheckSessionPerm(db, session, objProject, act); err != nil {
+		return err
+	} else if !ok {
 		return errors.New("no permission")
 	}
-	if err := access.RBAC0EnableRole(db, roleTenantAdmin); err != nil {
+
+	// delete dsd set
+	if err := access.RBAC0DeleteDSDSet(db, "dsd_user"); err != nil {
+		return err
+	}
+	if err := access.RBAC0AddActiveRole(db, session, roleSysUser); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeleteSession(db, session); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeassignUserRoles(db, user1, []perm.Role{roleSysUser}); err != nil {
 		return err
 	}
 
-	// clean role
-	if err := access.RBAC0CleanRolePerms(db, roleTenantAdmin); err != nil {
+	return nil
+}
+
+func checkDomains(db *gorm.DB) error {
+	// role: editor of tenant_1
+	if _, err := access.RBAC0CreateRole(db, domainTenant1, roleEditor, 0, "role_editor", "", false,
+		perm.Perm{Obj: objProject, Act: act}); err != nil {
 		return err
 	}
-	if tenantAdmin, err := access.RBAC0GetRolePerms(db, roleTenantAdmin); err != nil {
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant1, roleEditor, objProject, act); err != nil {
 		return err
-	} else if len(tenantAdmin.Perms) > 0 {
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if _, _, _, err := access.RBAC0CheckPerm(db, domainTenant2, roleEditor, objProject, act); !errors.Is(err, errs.ErrRoleNotFound) {
+		return errors.New("unexpected role")
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleEditor, []perm.Perm{
+		{Domain: domainTenant2, Obj: objProject, Act: act},
+	}); err == nil {
 		return errors.New("unexpected permission")
 	}
 
-	// grant & revoke perms
-	if err := access.RBAC0GrantRolePerms(db, roleTenantAdmin, []perm.Perm{
-		{Obj: objSystem, Act: act}, {Obj: objTenant, Act: act}, {Obj: objProject, Act: act},
+	// global role sys_user -> obj_tenant of tenant_1
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Domain: domainTenant1, Obj: objTenant, Act: act},
 	}); err != nil {
 		return err
 	}
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objSystem, act); err != nil {
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant1, roleSysUser, objTenant, act); err != nil {
 		return err
 	} else if !ok {
 		return errors.New("no permission")
 	}
-	if err := access.RBAC0RevokeRolePerms(db, roleTenantAdmin, []perm.Perm{
-		{Obj: objSystem, Act: act},
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant2, roleSysUser, objTenant, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+
+	// scoped listing
+	if _, count, err := access.RBAC0ListRoleInfo(db, domainTenant1, "", 0, 0, -1, 0); err != nil {
+		return err
+	} else if count != 5 {
+		return errors.New("unexpected count")
+	}
+	if _, count, err := access.RBAC0ListRoleInfo(db, domainTenant2, "", 0, 0, -1, 0); err != nil {
+		return err
+	} else if count != 4 {
+		return errors.New("unexpected count")
+	}
+	if roles, _, err := access.RBAC0ListRolePerms(db, domainTenant2, "role_sys_user", 0, 0, 10, 0); err != nil {
+		return err
+	} else if len(roles) != 1 || len(roles[0].Perms) != 0 {
+		return errors.New("unexpected permission")
+	}
+
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, []perm.Perm{
+		{Domain: domainTenant1, Obj: objTenant, Act: act},
 	}); err != nil {
 		return err
 	}
-	if ok, _, _, err := access.RBAC0CheckPerm(db, roleTenantAdmin, objSystem, act); err != nil {
+	if err := access.RBAC0DeleteRole(db, roleEditor); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkWildcards(db *gorm.DB) error {
+	// sys_user -> every act on everything under obj_project/
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objProject + "/*", Act: perm.Wildcard},
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/1", "read"); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject, act); err != nil {
 		return err
 	} else if ok {
 		return errors.New("unexpected permission")
 	}
-
-	// delete role
-	if err := access.RBAC0DeleteRole(db, roleTenantAdmin); err != nil {
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objProject + "/*", Act: perm.Wildcard},
+	}); err != nil {
 		return err
 	}
-	if _, err := access.RBAC0GetRolePerms(db, roleTenantAdmin); err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return err
-		}
-	} else {
-		return errors.New("unexpected role")
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/1", "read"); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
 	}
 
 	return nil
 }
 
-func deleteRoles(db *gorm.DB) error {
-	if err := access.RBAC0DeleteRole(db, roleSysAdmin); err != nil {
+func checkDenyRules(db *gorm.DB) error {
+	// sys_user -> everything under obj_project/ except obj_project/secret
+	denyPerms := []perm.Perm{
+		{Obj: objProject + "/*", Act: perm.Wildcard},
+		{Obj: objProject + "/secret", Act: perm.Wildcard, Effect: perm.EffectDeny},
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, denyPerms); err != nil {
 		return err
 	}
-	if err := access.RBAC0DeleteRole(db, roleTenantAdmin); err != nil {
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/1", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/secret", act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	// deny of one role overrides allow of another
+	if err := access.RBAC0GrantRolePerms(db, roleTenantUser, []perm.Perm{
+		{Obj: objProject + "/secret", Act: act},
+	}); err != nil {
+		return err
+	}
+	if ok, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleSysUser, roleTenantUser}, objProject+"/secret", act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	// admin is not affected by deny
+	if ok, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleSysAdmin, roleSysUser}, objProject+"/secret", act); err != nil {
 		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, denyPerms); err != nil {
+		return err
+	}
+	if ok, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleSysUser, roleTenantUser}, objProject+"/secret", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleTenantUser, []perm.Perm{
+		{Obj: objProject + "/secret", Act: act},
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkPermExpiry(db *gorm.DB) error {
+	now := time.Now().UnixMilli()
+	// sys_user -> obj_project/expired (expired), obj_project/pending (not yet valid), obj_project/temp (valid for 1h)
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objProject + "/expired", Act: act, ExpiresAt: now - 1000},
+		{Obj: objProject + "/pending", Act: act, NotBefore: now + time.Hour.Milliseconds()},
+		{Obj: objProject + "/temp", Act: act, ExpiresAt: now + time.Hour.Milliseconds()},
+	}); err != nil {
+		return err
+	}
+	for _, obj := range []perm.Obj{objProject + "/expired", objProject + "/pending"} {
+		if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, obj, act); err != nil {
+			return err
+		} else if ok {
+			return errors.New("unexpected permission")
+		}
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/temp", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 3 {
+		return errors.New("unexpected perms")
+	} else if expiring := rolePerms.ExpiringPerms(now, 2*time.Hour.Milliseconds()); len(expiring) != 1 || expiring[0].Obj != objProject+"/temp" {
+		return errors.New("unexpected expiring perms")
+	}
+	// re-grant updates the window
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objProject + "/pending", Act: act},
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject+"/pending", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	// sweep
+	if count, err := access.RBAC0SweepExpiredPerms(db); err != nil {
+		return err
+	} else if count != 1 {
+		return errors.New("unexpected sweep count")
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 2 {
+		return errors.New("unexpected perms")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objProject + "/pending", Act: act}, {Obj: objProject + "/temp", Act: act},
+	}); err != nil {
+		return err
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 0 {
+		return errors.New("unexpected perms")
+	}
+
+	return nil
+}
+
+func checkPermConds(db *gorm.DB) error {
+	const objInvoice, actApprove = "obj_invoice", "approve"
+	condPerms := []perm.Perm{
+		{Obj: objInvoice, Act: actApprove, Cond: "amount < 10000"},
+		{Obj: objInvoice, Act: actApprove, Cond: "region == 'blocked'", Effect: perm.EffectDeny},
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objInvoice, Act: actApprove, Cond: "amount <"},
+	}); err == nil {
+		return errors.New("unexpected cond")
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, condPerms); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPermWithAttrs(db, perm.GlobalDomain, roleSysUser, objInvoice, actApprove,
+		map[string]interface{}{"amount": 100, "region": "cn"}); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPermWithAttrs(db, perm.GlobalDomain, roleSysUser, objInvoice, actApprove,
+		map[string]interface{}{"amount": 20000, "region": "cn"}); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPermWithAttrs(db, perm.GlobalDomain, roleSysUser, objInvoice, actApprove,
+		map[string]interface{}{"amount": 100, "region": "blocked"}); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	// no attrs: conditional grants do not apply
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objInvoice, actApprove); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 2 || rolePerms.Perms[0].Cond == "" {
+		return errors.New("unexpected perms")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, condPerms); err != nil {
+		return err
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleSysUser); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 0 {
+		return errors.New("unexpected perms")
+	}
+
+	return nil
+}
+
+// manualWatcher delivers events only when emit is called
+type manualWatcher struct {
+	mu   sync.Mutex
+	subs map[int]func(watcher.Event)
+	next int
+}
+
+func newManualWatcher() *manualWatcher {
+	return &manualWatcher{subs: make(map[int]func(watcher.Event))}
+}
+
+func (w *manualWatcher) Publish(*gorm.DB, watcher.Event) error {
+	return nil
+}
+
+func (w *manualWatcher) Subscribe(fn func(watcher.Event)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.next
+	w.next++
+	w.subs[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+func (w *manualWatcher) Close() error {
+	return nil
+}
+
+func (w *manualWatcher) emit(ev watcher.Event) {
+	w.mu.Lock()
+	var fns []func(watcher.Event)
+	for _, fn := range w.subs {
+		fns = append(fns, fn)
+	}
+	w.mu.Unlock()
+	for _, fn := range fns {
+		fn(ev)
+	}
+}
+
+func (w *manualWatcher) subscribed() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.subs)
+}
+
+func checkCache(db *gorm.DB) error {
+	// the cache subscribes to the watcher already set on the controller
+	w1 := newManualWatcher()
+	if err := access.RBAC0SetWatcher(w1); err != nil {
+		return err
+	}
+	cached, err := access.EnableRBAC0Cache()
+	if err != nil {
+		return err
+	}
+	// sys_user inherits tenant_user
+	if err := access.RBAC0AddInheritance(db, roleSysUser, roleTenantUser); err != nil {
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject, act); err != nil {
+			return err
+		} else if !ok {
+			return errors.New("no permission")
+		}
+	}
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		return errors.New("unexpected cache stats")
+	}
+	// grant to tenant_user invalidates sys_user
+	if err := access.RBAC0GrantRolePerms(db, roleTenantUser, []perm.Perm{
+		{Obj: objSystem, Act: act},
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objSystem, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0DisableRole(db, roleSysUser); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objSystem, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	if err := access.RBAC0EnableRole(db, roleSysUser); err != nil {
+		return err
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleTenantUser, []perm.Perm{
+		{Obj: objSystem, Act: act},
+	}); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeleteInheritance(db, roleSysUser, roleTenantUser); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleSysUser, objProject, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	if stats := cached.Stats(); stats.Invalidations != 6 {
+		return errors.New("unexpected cache stats")
+	}
+	w1.emit(watcher.Event{Roles: []perm.Role{roleSysUser}})
+	if stats := cached.Stats(); stats.Invalidations != 7 {
+		return errors.New("watcher event not received by cache")
+	}
+	// replacing the watcher releases the previous subscription
+	w2 := newManualWatcher()
+	if err := access.RBAC0SetWatcher(w2); err != nil {
+		return err
+	}
+	if n := w1.subscribed(); n != 0 {
+		return fmt.Errorf("replaced watcher still has %d subscriptions", n)
+	}
+	w1.emit(watcher.Event{})
+	if stats := cached.Stats(); stats.Invalidations != 7 {
+		return errors.New("unexpected event from replaced watcher")
+	}
+	w2.emit(watcher.Event{})
+	if stats := cached.Stats(); stats.Invalidations != 8 {
+		return errors.New("watcher event not received by cache")
+	}
+
+	// deleting a role removes it from cached dsd sets
+	const roleAuditor perm.Role = 6
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleAuditor, 0, "role_auditor", "", false); err != nil {
+		return err
+	}
+	if err := access.RBAC0CreateDSDSet(db, "dsd_cache", []perm.Role{roleAuditor, roleTenantUser}, 2); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleAuditor, roleTenantUser}, objProject, act); !errors.Is(err, errs.ErrDSDViolation) {
+		return fmt.Errorf("unexpected dsd error: %v", err)
+	}
+	if err := access.RBAC0DeleteRole(db, roleAuditor); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleAuditor, 0, "role_auditor", "", false); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0CheckPerms(db, perm.GlobalDomain, []perm.Role{roleAuditor, roleTenantUser}, objProject, act); err != nil {
+		return fmt.Errorf("deleted role still in cached dsd set: %v", err)
+	}
+	if err := access.RBAC0DeleteDSDSet(db, "dsd_cache"); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeleteRole(db, roleAuditor); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkWatcher(db *gorm.DB) error {
+	// w1 for this instance, w2 simulates another instance sharing the db
+	w1, err := watcher.NewDBWatcher(db, 10*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer w1.Close()
+	w2, err := watcher.NewDBWatcher(db, 10*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer w2.Close()
+	events := make(chan watcher.Event, 16)
+	unsubscribe := w2.Subscribe(func(ev watcher.Event) {
+		events <- ev
+	})
+	if err := access.RBAC0SetWatcher(w1); err != nil {
+		return err
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objSystem, Act: act},
+	}); err != nil {
+		return err
+	}
+	select {
+	case ev := <-events:
+		if len(ev.Roles) != 1 || ev.Roles[0] != roleSysUser {
+			return errors.New("unexpected event")
+		}
+	case <-time.After(time.Second):
+		return errors.New("event timeout")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleSysUser, []perm.Perm{
+		{Obj: objSystem, Act: act},
+	}); err != nil {
+		return err
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		return errors.New("event timeout")
+	}
+	// no events after unsubscribing
+	unsubscribe()
+	if err := access.RBAC0EnableRole(db, roleSysUser); err != nil {
+		return err
+	}
+	select {
+	case <-events:
+		return errors.New("unexpected event after unsubscribe")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	return nil
+}
+
+func checkDecisions(db *gorm.DB) error {
+	// tenant_admin inherits tenant_user, and is denied obj_project/secret
+	if err := access.RBAC0AddInheritance(db, roleTenantAdmin, roleTenantUser); err != nil {
+		return err
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleTenantAdmin, []perm.Perm{
+		{Obj: objProject + "/secret", Act: act, Effect: perm.EffectDeny},
+	}); err != nil {
+		return err
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, roleTenantAdmin, objProject, act); err != nil {
+		return err
+	} else if !d.Allowed || d.Reason != perm.ReasonGranted || d.Role != roleTenantAdmin || d.GrantRole != roleTenantAdmin || d.Grant == nil {
+		return errors.New("unexpected decision")
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, roleTenantAdmin, objSystem, act); err != nil {
+		return err
+	} else if d.Allowed || d.Reason != perm.ReasonNoGrant {
+		return errors.New("unexpected decision")
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, roleSysAdmin, objSystem, act); err != nil {
+		return err
+	} else if !d.Allowed || d.Reason != perm.ReasonAdminBypass {
+		return errors.New("unexpected decision")
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, 100, objSystem, act); err != nil {
+		return err
+	} else if d.Allowed || d.Reason != perm.ReasonRoleNotFound || d.Role != 100 {
+		return errors.New("unexpected decision")
+	}
+	if d, err := access.RBAC0DecideMany(db, perm.GlobalDomain, []perm.Role{roleTenantUser, roleTenantAdmin}, objProject+"/secret", act); err != nil {
+		return err
+	} else if d.Allowed || d.Reason != perm.ReasonDenied || d.Role != roleTenantAdmin || d.Grant.Effect != perm.EffectDeny {
+		return errors.New("unexpected decision")
+	}
+	if err := access.RBAC0DisableRole(db, roleTenantAdmin); err != nil {
+		return err
+	}
+	if d, err := access.RBAC0DecideMany(db, perm.GlobalDomain, []perm.Role{100, roleTenantAdmin}, objProject, act); err != nil {
+		return err
+	} else if d.Allowed || d.Reason != perm.ReasonRoleDisabled || d.Role != roleTenantAdmin {
+		return errors.New("unexpected decision")
+	}
+	if err := access.RBAC0EnableRole(db, roleTenantAdmin); err != nil {
+		return err
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleTenantAdmin, []perm.Perm{
+		{Obj: objProject + "/secret", Act: act, Effect: perm.EffectDeny},
+	}); err != nil {
+		return err
+	}
+	if err := access.RBAC0DeleteInheritance(db, roleTenantAdmin, roleTenantUser); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkExplain(db *gorm.DB) error {
+	trace, err := access.RBAC0Explain(db, perm.GlobalDomain, []perm.Role{100, roleTenantAdmin}, objProject, act)
+	if err != nil {
+		return err
+	}
+	if trace.Decision == nil || !trace.Decision.Allowed || trace.Decision.Reason != perm.ReasonGranted {
+		return errors.New("unexpected explain decision")
+	}
+	if len(trace.Steps) == 0 || trace.Steps[0].Kind != perm.TraceStepRole || trace.Steps[0].Role != 100 {
+		return errors.New("unexpected explain steps")
+	}
+	var matched bool
+	for _, step := range trace.Steps {
+		if step.Kind == perm.TraceStepGrant && step.Matched && step.Role == roleTenantAdmin && step.Grant != nil {
+			matched = true
+		}
+	}
+	if !matched {
+		return errors.New("explain matched grant not found")
+	}
+	if last := trace.Steps[len(trace.Steps)-1]; last.Kind != perm.TraceStepDecision {
+		return errors.New("unexpected explain steps")
+	}
+	if !strings.Contains(trace.String(), "reason=granted") {
+		return errors.New("unexpected explain text")
+	}
+	data, err := trace.JSON()
+	if err != nil {
+		return err
+	}
+	var decoded perm.Trace
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if len(decoded.Steps) != len(trace.Steps) || decoded.Decision == nil || decoded.Decision.Reason != perm.ReasonGranted {
+		return errors.New("unexpected explain json")
+	}
+	return nil
+}
+
+func checkAuditLogs(db *gorm.DB) error {
+	const actor = 42
+	tx := db.WithContext(audit.WithActor(context.Background(), actor))
+	since := time.Now().UnixMilli()
+	perms := []perm.Perm{{Obj: objTenant + "/audit", Act: act}}
+	if err := access.RBAC0GrantRolePerms(tx, roleTenantUser, perms); err != nil {
+		return err
+	}
+	if err := access.RBAC0RevokeRolePerms(tx, roleTenantUser, perms); err != nil {
+		return err
+	}
+	hasPerm := func(rp *perm.RolePerms) bool {
+		if rp == nil {
+			return false
+		}
+		for _, p := range rp.Perms {
+			if p.Obj == perms[0].Obj && p.Act == perms[0].Act {
+				return true
+			}
+		}
+		return false
+	}
+	entries, count, err := access.RBAC0ListAuditLogs(db, audit.Query{Role: roleTenantUser, Actor: actor, Since: since, Limit: -1})
+	if err != nil {
+		return err
+	}
+	if count != 2 || len(entries) != 2 {
+		return errors.New("unexpected audit logs count")
+	}
+	if entries[0].Action != audit.ActionGrantPerms || hasPerm(entries[0].Before) || !hasPerm(entries[0].After) {
+		return errors.New("unexpected grant audit log")
+	}
+	if entries[1].Action != audit.ActionRevokePerms || !hasPerm(entries[1].Before) || hasPerm(entries[1].After) {
+		return errors.New("unexpected revoke audit log")
+	}
+	if entries, _, err = access.RBAC0ListAuditLogs(db, audit.Query{Actor: actor, Since: since, Limit: 1, Order: -1}); err != nil {
+		return err
+	} else if len(entries) != 1 || entries[0].Action != audit.ActionRevokePerms {
+		return errors.New("unexpected audit logs order")
+	}
+	if _, count, err = access.RBAC0ListAuditLogs(db, audit.Query{Role: roleTenantUser, Action: audit.ActionCreateRole, Limit: -1}); err != nil {
+		return err
+	} else if count == 0 {
+		return errors.New("create role audit log not found")
+	}
+	if _, count, err = access.RBAC0ListAuditLogs(db, audit.Query{Actor: actor, Until: since, Limit: -1}); err != nil {
+		return err
+	} else if count != 0 {
+		return errors.New("unexpected audit logs time range")
+	}
+	return nil
+}
+
+// countSink counts decision log records
+type countSink struct {
+	mu      sync.Mutex
+	records []*decisionlog.Record
+	closed  bool
+}
+
+func (s *countSink) Write(r *decisionlog.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *countSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// closeErrController fails to close
+type closeErrController struct {
+	access.IRBAC0Controller
+}
+
+func (c *closeErrController) Close(ctx context.Context) error {
+	return errClose
+}
+
+var errClose = errors.New("close")
+
+func checkDecisionLog(db *gorm.DB) error {
+	f, err := os.CreateTemp("", "decision_log_*.jsonl")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	defer os.Remove(f.Name())
+	fileSink, err := decisionlog.NewFileSink(f.Name())
+	if err != nil {
+		return err
+	}
+	logged, err := access.EnableRBAC0DecisionLog(decisionlog.NewLogger(fileSink, decisionlog.Options{}))
+	if err != nil {
+		return err
+	}
+	requestID := fmt.Sprintf("req-%d", time.Now().UnixNano())
+	tx := db.WithContext(decisionlog.WithRequestID(context.Background(), requestID))
+	if ok, _, _, err := access.RBAC0CheckPerm(tx, perm.GlobalDomain, roleTenantAdmin, objProject, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, err := access.RBAC0CheckPerms(tx, perm.GlobalDomain, []perm.Role{roleTenantUser}, objSystem+"/none", act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	// json lines file sink
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	var records []*decisionlog.Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		r := &decisionlog.Record{}
+		if err := json.Unmarshal([]byte(line), r); err != nil {
+			return err
+		}
+		if r.RequestID == requestID {
+			records = append(records, r)
+		}
+	}
+	if len(records) != 2 || !records[0].Allowed || records[1].Allowed ||
+		len(records[1].Roles) != 1 || records[1].Roles[0] != roleTenantUser || records[0].Latency <= 0 {
+		return errors.New("unexpected file decision logs")
+	}
+	// deny only gorm table sink
+	dbSink, err := decisionlog.NewDBSink(db)
+	if err != nil {
+		return err
+	}
+	denyLogged := access.NewLoggedRBAC0Controller(logged.IRBAC0Controller, decisionlog.NewLogger(dbSink, decisionlog.Options{DenyOnly: true}))
+	ctx := decisionlog.WithRequestID(context.Background(), requestID)
+	if _, err := denyLogged.Decide(ctx, perm.GlobalDomain, roleTenantAdmin, objProject, act); err != nil {
+		return err
+	}
+	if _, err := denyLogged.Decide(ctx, perm.GlobalDomain, 100, objProject, act); err != nil {
+		return err
+	}
+	var dbLogs []*model.DecisionLog
+	if err := db.Where("request_id = ?", requestID).Find(&dbLogs).Error; err != nil {
+		return err
+	}
+	if len(dbLogs) != 1 || dbLogs[0].Allowed || dbLogs[0].Reason != perm.ReasonRoleNotFound.String() {
+		return errors.New("unexpected db decision logs")
+	}
+	// sampling
+	sink := &countSink{}
+	sampled := access.NewLoggedRBAC0Controller(logged.IRBAC0Controller, decisionlog.NewLogger(sink, decisionlog.Options{SampleRate: 0.5}))
+	for i := 0; i < 200; i++ {
+		if _, err := sampled.CheckPerms(ctx, perm.GlobalDomain, []perm.Role{roleTenantAdmin}, objProject, act); err != nil {
+			return err
+		}
+	}
+	if len(sink.records) == 0 || len(sink.records) == 200 {
+		return errors.New("unexpected sampled decision logs")
+	}
+	// session checks are logged in the session's domain
+	session, err := access.RBAC0CreateSession(db, domainTenant1, 900)
+	if err != nil {
+		return err
+	}
+	if s, err := access.RBAC0GetSession(db, session); err != nil {
+		return err
+	} else if s.Domain != domainTenant1 || s.User != 900 || len(s.Roles) != 0 {
+		return errors.New("unexpected session info")
+	}
+	sink = &countSink{}
+	sessionLogged := access.NewLoggedRBAC0Controller(logged.IRBAC0Controller, decisionlog.NewLogger(sink, decisionlog.Options{}))
+	if _, err := sessionLogged.CheckSessionPerm(ctx, session, objProject, act); err != nil {
+		return err
+	}
+	if _, err := sessionLogged.CheckSessionPermTx(db.WithContext(ctx), session, objProject, act); err != nil {
+		return err
+	}
+	if len(sink.records) != 2 || sink.records[0].Domain != domainTenant1 || sink.records[1].Domain != domainTenant1 ||
+		sink.records[0].Session != session {
+		return errors.New("unexpected session decision logs")
+	}
+	// the logger is closed even if the wrapped controller fails to close
+	sink = &countSink{}
+	closing := access.NewLoggedRBAC0Controller(&closeErrController{logged.IRBAC0Controller}, decisionlog.NewLogger(sink, decisionlog.Options{}))
+	if err := closing.Close(ctx); !errors.Is(err, errClose) || !sink.closed {
+		return fmt.Errorf("unexpected close error: %v", err)
+	}
+	return access.RBAC0DeleteSession(db, session)
+}
+
+func checkTransaction(db *gorm.DB) error {
+	p := perm.Perm{Obj: objProject + "/tx", Act: act}
+	errRollback := errors.New("rollback")
+	// changes are visible inside the transaction and discarded on rollback
+	if err := access.RBAC0Transaction(db, func(tx *gorm.DB) error {
+		if _, err := access.RBAC0CreateRole(tx, domainTenant1, roleEditor, 0, "role_editor", "", false, p); err != nil {
+			return err
+		}
+		if ok, _, _, err := access.RBAC0CheckPerm(tx, domainTenant1, roleEditor, p.Obj, p.Act); err != nil {
+			return err
+		} else if !ok {
+			return errors.New("grant not visible in transaction")
+		}
+		return errRollback
+	}); !errors.Is(err, errRollback) {
+		return fmt.Errorf("unexpected transaction error: %v", err)
+	}
+	if _, err := access.RBAC0GetRolePerms(db, roleEditor); !errors.Is(err, errs.ErrRoleNotFound) {
+		return errors.New("rolled back role still exists")
+	}
+	if d, err := access.RBAC0Explain(db, domainTenant1, []perm.Role{roleEditor}, p.Obj, p.Act); err != nil {
+		return err
+	} else if d.Decision.Reason != perm.ReasonRoleNotFound {
+		return errors.New("rolled back role still effective")
+	}
+	// committed changes are applied together
+	if err := access.RBAC0Transaction(db, func(tx *gorm.DB) error {
+		if _, err := access.RBAC0CreateRole(tx, domainTenant1, roleEditor, 0, "role_editor", "", false, p); err != nil {
+			return err
+		}
+		return access.RBAC0AddInheritance(tx, roleEditor, roleTenantUser)
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant1, roleEditor, p.Obj, p.Act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("committed grant not effective")
+	}
+	if descendants, err := access.RBAC0ListDescendants(db, roleEditor); err != nil {
+		return err
+	} else if len(descendants) != 1 || descendants[0] != roleTenantUser {
+		return errors.New("committed inheritance not effective")
+	}
+	return access.RBAC0DeleteRole(db, roleEditor)
+}
+
+func checkErrors(db *gorm.DB) error {
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleTenantUser, 0, "role_tenant_user", "", false); !errors.Is(err, errs.ErrRoleExists) {
+		return fmt.Errorf("unexpected create error: %v", err)
+	}
+	// storage errors are still wrapped
+	if _, err := access.RBAC0GetRoleInfo(db, 100); !errors.Is(err, errs.ErrRoleNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("unexpected get error: %v", err)
+	}
+	if err := access.RBAC0GrantRolePerms(db, 100, []perm.Perm{{Obj: objProject, Act: act}}); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected grant error: %v", err)
+	}
+	if err := access.RBAC0AddInheritance(db, roleTenantUser, 100); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected inheritance error: %v", err)
+	}
+	if err := access.RBAC0CleanRolePerms(db, 100); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected clean error: %v", err)
+	}
+	if err := access.RBAC0UpdateRole(db, 100, "role_missing", ""); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected update error: %v", err)
+	}
+	if err := access.RBAC0EnableRole(db, 100); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected enable error: %v", err)
+	}
+	if err := access.RBAC0DisableRole(db, 100); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected disable error: %v", err)
+	}
+	if err := access.RBAC0DeleteRole(db, 100); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected delete error: %v", err)
+	}
+	if err := access.RBAC0DeleteSSDSet(db, "ssd_missing"); !errors.Is(err, errs.ErrConstraintNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("unexpected ssd error: %v", err)
+	}
+	if err := access.RBAC0DeleteDSDSet(db, "dsd_missing"); !errors.Is(err, errs.ErrConstraintNotFound) {
+		return fmt.Errorf("unexpected dsd error: %v", err)
+	}
+	if _, _, err := access.RBAC0ListRoleInfo(db, perm.GlobalDomain, "", 0, -1, 10, 0); !errors.Is(err, errs.ErrInvalidPagination) {
+		return fmt.Errorf("unexpected list error: %v", err)
+	}
+	if _, _, err := access.RBAC0ListAuditLogs(db, audit.Query{Limit: 0}); !errors.Is(err, errs.ErrInvalidPagination) {
+		return fmt.Errorf("unexpected list error: %v", err)
+	}
+	// an unset limit is rejected, only -1 means no pagination
+	if _, _, err := access.RBAC0ListRoleInfo(db, perm.GlobalDomain, "", 0, 0, 0, 0); !errors.Is(err, errs.ErrInvalidPagination) {
+		return fmt.Errorf("unexpected list error: %v", err)
+	}
+	if _, _, err := access.RBAC0ListRolePerms(db, perm.GlobalDomain, "", 0, 0, 0, 0); !errors.Is(err, errs.ErrInvalidPagination) {
+		return fmt.Errorf("unexpected list error: %v", err)
+	}
+	if err := access.InitAccessRBAC0Controller(db); !errors.Is(err, errs.ErrAlreadyInitialized) {
+		return fmt.Errorf("unexpected init error: %v", err)
+	}
+	if err := access.RBAC0AddInheritance(db, roleTenantUser, roleTenantUser); !errors.Is(err, errs.ErrInheritanceCycle) {
+		return fmt.Errorf("unexpected inheritance error: %v", err)
+	}
+	if err := access.RBAC0CreateSSDSet(db, "ssd_invalid", []perm.Role{roleTenantUser}, 2); !errors.Is(err, errs.ErrInvalidConstraint) {
+		return fmt.Errorf("unexpected ssd error: %v", err)
+	}
+	// "*" is reserved for the global domain
+	if _, err := access.RBAC0CreateRole(db, "*", 0, 0, "role_reserved_domain", "", false); !errors.Is(err, errs.ErrInvalidDomain) {
+		return fmt.Errorf("unexpected domain error: %v", err)
+	}
+	if err := access.RBAC0GrantRolePerms(db, roleSysUser, []perm.Perm{{Domain: "*", Obj: objProject, Act: act}}); !errors.Is(err, errs.ErrInvalidDomain) {
+		return fmt.Errorf("unexpected domain error: %v", err)
+	}
+	if _, err := access.RBAC0CreateSession(db, "*", 1); !errors.Is(err, errs.ErrInvalidDomain) {
+		return fmt.Errorf("unexpected domain error: %v", err)
+	}
+	// sessions
+	if _, err := access.RBAC0ListSessionRoles(db, 1<<40); !errors.Is(err, errs.ErrSessionNotFound) || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("unexpected session error: %v", err)
+	}
+	if _, err := access.RBAC0CheckSessionPerm(db, 1<<40, objProject, act); !errors.Is(err, errs.ErrSessionNotFound) {
+		return fmt.Errorf("unexpected session error: %v", err)
+	}
+	session, err := access.RBAC0CreateSession(db, perm.GlobalDomain, 901)
+	if err != nil {
+		return err
+	}
+	if err := access.RBAC0AddActiveRole(db, session, roleTenantUser); !errors.Is(err, errs.ErrRoleNotAssigned) {
+		return fmt.Errorf("unexpected session error: %v", err)
+	}
+	if err := access.RBAC0DeleteSession(db, session); err != nil {
+		return err
+	}
+	// decisions as errors
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, 100, objSystem, act); err != nil {
+		return err
+	} else if !errors.Is(d.Err(), errs.ErrRoleNotFound) {
+		return errors.New("unexpected decision error")
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, roleTenantUser, objSystem, act); err != nil {
+		return err
+	} else if !errors.Is(d.Err(), errs.ErrPermissionDenied) {
+		return errors.New("unexpected decision error")
+	}
+	if d, err := access.RBAC0Decide(db, perm.GlobalDomain, roleSysAdmin, objSystem, act); err != nil {
+		return err
+	} else if d.Err() != nil {
+		return errors.New("unexpected decision error")
+	}
+	return nil
+}
+
+func checkRoleQuery(db *gorm.DB) error {
+	const creator = 7
+	p := perm.Perm{Obj: objProject + "/query", Act: act}
+	if _, err := access.RBAC0CreateRole(db, domainTenant1, roleEditor, creator, "role_query_editor", "", false, p); err != nil {
+		return err
+	}
+	if err := access.RBAC0DisableRole(db, roleEditor); err != nil {
+		return err
+	}
+	disabled, isAdmin := false, true
+	// filters
+	if roles, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{Creator: creator}); err != nil {
+		return err
+	} else if count != 1 || len(roles) != 1 || roles[0].Role != roleEditor {
+		return errors.New("unexpected roles by creator")
+	}
+	if roles, _, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{Name: "role_query_editor", Enable: &disabled}); err != nil {
+		return err
+	} else if len(roles) != 1 || roles[0].Role != roleEditor {
+		return errors.New("unexpected roles by name")
+	}
+	if roles, _, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{IsAdmin: &isAdmin}); err != nil {
+		return err
+	} else if len(roles) != 1 || roles[0].Role != roleSysAdmin {
+		return errors.New("unexpected admin roles")
+	}
+	if roles, err := access.RBAC0GetRoleInfo(db, roleEditor); err != nil {
+		return err
+	} else if _, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{CreatedSince: roles.CreatedAt, CreatedUntil: roles.CreatedAt + 1}); err != nil {
+		return err
+	} else if count < 1 {
+		return errors.New("unexpected roles by created time")
+	}
+	if rolePerms, _, err := access.RBAC0QueryRolePerms(db, perm.RoleQuery{Domain: domainTenant1, Obj: p.Obj, Act: p.Act}); err != nil {
+		return err
+	} else if len(rolePerms) != 1 || rolePerms[0].Role != roleEditor || len(rolePerms[0].Perms) != 1 {
+		return errors.New("unexpected roles by perm")
+	}
+	if _, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{Domain: domainTenant2, Obj: p.Obj}); err != nil {
+		return err
+	} else if count != 0 {
+		return errors.New("unexpected roles by perm in domain")
+	}
+	// sort and pagination
+	if roles, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{
+		Roles:  []perm.Role{roleSysAdmin, roleTenantAdmin, roleTenantUser, roleEditor},
+		SortBy: perm.RoleSortName,
+		Desc:   true,
+		Offset: 1,
+		Limit:  2,
+	}); err != nil {
+		return err
+	} else if count != 4 || len(roles) != 2 || roles[0].Role != roleTenantAdmin || roles[1].Role != roleSysAdmin {
+		return errors.New("unexpected sorted roles")
+	}
+	if _, _, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{SortBy: "desc; drop table roles"}); !errors.Is(err, errs.ErrInvalidQuery) {
+		return fmt.Errorf("unexpected query error: %v", err)
+	}
+	return access.RBAC0DeleteRole(db, roleEditor)
+}
+
+func checkRolePages(db *gorm.DB) error {
+	roles := []perm.Role{roleSysAdmin, roleTenantAdmin, roleTenantUser, roleSysUser, roleEditor}
+	page, err := access.RBAC0PageRoleInfo(db, perm.RoleQuery{Roles: roles, Limit: 3, WithCount: true})
+	if err != nil {
+		return err
+	} else if page.Count != 4 || len(page.Items) != 3 || page.Items[2].Role != roleTenantUser || page.Next == "" {
+		return errors.New("unexpected first page")
+	}
+	// roles created between pages do not shift the next page
+	if _, err := access.RBAC0CreateRole(db, perm.GlobalDomain, roleEditor, 0, "role_editor", "", false); err != nil {
+		return err
+	}
+	if page, err = access.RBAC0PageRoleInfo(db, perm.RoleQuery{Roles: roles, Limit: 3, Cursor: page.Next}); err != nil {
+		return err
+	} else if page.Count != -1 || len(page.Items) != 2 || page.Items[0].Role != roleSysUser || page.Items[1].Role != roleEditor || page.Next != "" {
+		return errors.New("unexpected second page")
+	}
+	// sorted by name
+	var names []string
+	q := perm.RoleQuery{Roles: roles[:4], SortBy: perm.RoleSortName, Desc: true, Limit: 2}
+	for {
+		page, err := access.RBAC0PageRolePerms(db, q)
+		if err != nil {
+			return err
+		}
+		for _, rolePerms := range page.Items {
+			names = append(names, rolePerms.Name)
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	if strings.Join(names, ",") != "role_tenant_user,role_tenant_admin,role_sys_user,role_sys_admin" {
+		return fmt.Errorf("unexpected sorted pages: %v", names)
+	}
+	// invalid cursors
+	if _, err := access.RBAC0PageRoleInfo(db, perm.RoleQuery{Limit: 2, Cursor: q.Cursor}); !errors.Is(err, errs.ErrInvalidCursor) {
+		return fmt.Errorf("unexpected cursor error: %v", err)
+	}
+	if _, err := access.RBAC0PageRoleInfo(db, perm.RoleQuery{Limit: 2, Cursor: "?"}); !errors.Is(err, errs.ErrInvalidCursor) {
+		return fmt.Errorf("unexpected cursor error: %v", err)
+	}
+	if _, err := access.RBAC0PageRoleInfo(db, perm.RoleQuery{Offset: 1, Cursor: q.Cursor}); !errors.Is(err, errs.ErrInvalidPagination) {
+		return fmt.Errorf("unexpected cursor error: %v", err)
+	}
+	if _, _, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{Cursor: q.Cursor}); !errors.Is(err, errs.ErrInvalidQuery) {
+		return fmt.Errorf("unexpected cursor error: %v", err)
+	}
+	return access.RBAC0DeleteRole(db, roleEditor)
+}
+
+func checkPolicyFiles(db *gorm.DB) error {
+	// merge: create editor, update sys_user
+	file := `
+roles:
+  - id: 5
+    domain: tenant_1
+    name: role_editor
+    perms:
+      - obj: obj_project/policy
+        act: act
+      - obj: obj_project/policy/secret
+        act: act
+        effect: deny
+  - id: 4
+    name: role_sys_user
+    desc: managed by policy file
+`
+	if err := access.RBAC0ImportPolicy(db, strings.NewReader(file), policy.FormatYAML, policy.ImportMerge); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant1, roleEditor, objProject+"/policy", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("imported perm not effective")
+	}
+	if info, err := access.RBAC0GetRoleInfo(db, roleSysUser); err != nil {
+		return err
+	} else if info.Desc != "managed by policy file" || !info.Enable {
+		return errors.New("imported role not updated")
+	}
+	// export
+	var buf bytes.Buffer
+	if err := access.RBAC0ExportPolicy(db, &buf, policy.FormatJSON); err != nil {
+		return err
+	}
+	p, err := policy.Decode(&buf, policy.FormatJSON)
+	if err != nil {
+		return err
+	}
+	var editor *policy.Role
+	for _, r := range p.Roles {
+		if r.ID == roleSysAdmin && !r.IsAdmin {
+			return errors.New("unexpected exported admin")
+		}
+		if r.ID == roleEditor {
+			editor = r
+		}
+	}
+	if editor == nil || editor.Domain != domainTenant1 || len(editor.Perms) != 2 {
+		return errors.New("unexpected exported role")
+	}
+	// replace: revoke the deny perm and disable editor, other roles unchanged
+	editor.Enable = false
+	editor.Perms = editor.Perms[:0]
+	editor.Perms = append(editor.Perms, policy.Perm{Domain: domainTenant1, Obj: objProject + "/policy", Act: act})
+	buf.Reset()
+	if err := policy.Encode(&buf, p, policy.FormatYAML); err != nil {
+		return err
+	}
+	if err := access.RBAC0ImportPolicy(db, &buf, policy.FormatYAML, policy.ImportReplace); err != nil {
+		return err
+	}
+	if rolePerms, err := access.RBAC0GetRolePerms(db, roleEditor); err != nil {
+		return err
+	} else if rolePerms.Enable || len(rolePerms.Perms) != 1 || rolePerms.Perms[0].Effect != perm.EffectAllow {
+		return errors.New("unexpected replaced role")
+	}
+	if _, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{}); err != nil {
+		return err
+	} else if count != int64(len(p.Roles)) {
+		return errors.New("unexpected replaced roles")
+	}
+	// replace: roles not in the file are deleted
+	roles := p.Roles[:0]
+	for _, r := range p.Roles {
+		if r.ID != roleEditor {
+			roles = append(roles, r)
+		}
+	}
+	p.Roles = roles
+	buf.Reset()
+	if err := policy.Encode(&buf, p, policy.FormatJSON); err != nil {
+		return err
+	}
+	if err := access.RBAC0ImportPolicy(db, &buf, policy.FormatJSON, policy.ImportReplace); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0GetRoleInfo(db, roleEditor); !errors.Is(err, errs.ErrRoleNotFound) {
+		return errors.New("replaced role still exists")
+	}
+	// invalid files
+	if err := access.RBAC0ImportPolicy(db, strings.NewReader("roles: [{name: no_id}]"), policy.FormatYAML, policy.ImportMerge); err == nil {
+		return errors.New("unexpected import")
+	}
+	if err := access.RBAC0ImportPolicy(db, strings.NewReader(`{"roles": [{"id": 1, "name": "role_sys_admin"}]}`), policy.FormatJSON, policy.ImportMerge); err == nil {
+		return errors.New("unexpected import of admin flag")
+	}
+	// empty files do not delete roles
+	for _, f := range []struct {
+		text   string
+		format policy.Format
+		mode   policy.ImportMode
+	}{
+		{"", policy.FormatYAML, policy.ImportReplace},
+		{"  \n", policy.FormatJSON, policy.ImportReplace},
+		{"# no roles\n", policy.FormatYAML, policy.ImportMerge},
+		{"roles: []", policy.FormatYAML, policy.ImportReplace},
+		{"{}", policy.FormatJSON, policy.ImportReplace},
+	} {
+		if err := access.RBAC0ImportPolicy(db, strings.NewReader(f.text), f.format, f.mode); !errors.Is(err, policy.ErrEmptyPolicy) {
+			return fmt.Errorf("unexpected import of empty file %q: %v", f.text, err)
+		}
+	}
+	if _, count, err := access.RBAC0QueryRoleInfo(db, perm.RoleQuery{}); err != nil {
+		return err
+	} else if count != int64(len(p.Roles)) {
+		return errors.New("roles deleted by empty file")
+	}
+	return nil
+}
+
+func checkPolicyPlan(db *gorm.DB) error {
+	desired := &policy.Policy{Roles: []*policy.Role{
+		{ID: roleEditor, Domain: domainTenant1, Name: "role_editor", Enable: true, Perms: []policy.Perm{{Obj: objProject + "/plan", Act: act}}},
+		{ID: roleSysUser, Name: "role_sys_user", Desc: "managed by plan", Enable: true},
+	}}
+	// roles not in the file are deleted unless protected
+	if plan, err := access.RBAC0PlanPolicy(db, desired, policy.PlanOptions{}); err != nil {
+		return err
+	} else if len(plan.Create) != 1 || len(plan.Update) != 1 || len(plan.Delete) != 3 || !strings.Contains(plan.String(), fmt.Sprintf("- role %d", roleSysAdmin)) {
+		return fmt.Errorf("unexpected plan:\n%s", plan)
+	}
+	plan, err := access.RBAC0PlanPolicy(db, desired, policy.PlanOptions{Protect: true})
+	if err != nil {
+		return err
+	} else if len(plan.Delete) != 0 {
+		return fmt.Errorf("unexpected protected plan:\n%s", plan)
+	}
+	if diff := plan.String(); !strings.Contains(diff, fmt.Sprintf("+ role %d \"role_editor\" domain=%s", roleEditor, domainTenant1)) ||
+		!strings.Contains(diff, `desc: "managed by policy file" -> "managed by plan"`) {
+		return fmt.Errorf("unexpected diff:\n%s", diff)
+	}
+	if err := access.RBAC0ApplyPlan(db, plan); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, domainTenant1, roleEditor, objProject+"/plan", act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("applied perm not effective")
+	}
+	if info, err := access.RBAC0GetRoleInfo(db, roleSysUser); err != nil {
+		return err
+	} else if info.Desc != "managed by plan" {
+		return errors.New("applied role not updated")
+	}
+	if plan, err := access.RBAC0PlanPolicy(db, desired, policy.PlanOptions{Protect: true}); err != nil {
+		return err
+	} else if !plan.Empty() {
+		return fmt.Errorf("unexpected plan after apply:\n%s", plan)
+	}
+	// a stale plan is rolled back as a whole
+	if err := access.RBAC0ApplyPlan(db, plan); !errors.Is(err, errs.ErrRoleExists) {
+		return fmt.Errorf("unexpected apply error: %v", err)
+	}
+	return access.RBAC0DeleteRole(db, roleEditor)
+}
+
+func checkTenantAdminPerms(db *gorm.DB) error {
+	// list infos
+	if _, count, err := access.RBAC0ListRoleInfo(db, perm.GlobalDomain, "tenant", 1, 0, 10, -1); err != nil {
+		return err
+	} else if count != 2 {
+		return errors.New("unexpected count")
+	}
+
+	// list perms
+	if _, count, err := access.RBAC0ListRolePerms(db, perm.GlobalDomain, "tenant", 1, 0, 10, -1); err != nil {
+		return err
+	} else if count != 2 {
+		return errors.New("unexpected count")
+	}
+
+	// check perms
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objSystem, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objTenant, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objProject, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+
+	// enable & disable role
+	if err := access.RBAC0DisableRole(db, roleTenantAdmin); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objTenant, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0EnableRole(db, roleTenantAdmin); err != nil {
+		return err
+	}
+
+	// clean role
+	if err := access.RBAC0CleanRolePerms(db, roleTenantAdmin); err != nil {
+		return err
+	}
+	if tenantAdmin, err := access.RBAC0GetRolePerms(db, roleTenantAdmin); err != nil {
+		return err
+	} else if len(tenantAdmin.Perms) > 0 {
+		return errors.New("unexpected permission")
+	}
+
+	// grant & revoke perms
+	if err := access.RBAC0GrantRolePerms(db, roleTenantAdmin, []perm.Perm{
+		{Obj: objSystem, Act: act}, {Obj: objTenant, Act: act}, {Obj: objProject, Act: act},
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objSystem, act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("no permission")
+	}
+	if err := access.RBAC0RevokeRolePerms(db, roleTenantAdmin, []perm.Perm{
+		{Obj: objSystem, Act: act},
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := access.RBAC0CheckPerm(db, perm.GlobalDomain, roleTenantAdmin, objSystem, act); err != nil {
+		return err
+	} else if ok {
+		return errors.New("unexpected permission")
+	}
+
+	// delete role
+	if err := access.RBAC0DeleteRole(db, roleTenantAdmin); err != nil {
+		return err
+	}
+	if _, err := access.RBAC0GetRolePerms(db, roleTenantAdmin); err != nil {
+		if !errors.Is(err, errs.ErrRoleNotFound) {
+			return err
+		}
+	} else {
+		return errors.New("unexpected role")
+	}
+
+	return nil
+}
+
+func checkLifecycle() error {
+	ctx := context.Background()
+	if err := access.RBAC0Health(ctx); err != nil {
+		return err
+	}
+	ctl := access.SetRBAC0Controller(nil)
+	if err := access.RBAC0Health(ctx); err == nil {
+		return errors.New("unexpected health of unset controller")
+	}
+	access.SetRBAC0Controller(ctl)
+	if err := access.ResetRBAC0Controller(ctx); err != nil {
+		return err
+	}
+	if err := access.RBAC0Health(ctx); err == nil {
+		return errors.New("unexpected health of reset controller")
+	}
+	if err := ctl.Health(ctx); !errors.Is(err, errs.ErrClosed) {
+		return errors.New("unexpected health of closed controller")
+	}
+	// closing again is a no-op
+	return ctl.Close(ctx)
+}
+
+func deleteRoles(db *gorm.DB) error {
+	if err := access.RBAC0DeleteRole(db, roleSysAdmin); err != nil {
+		return err
+	}
+	// deleted in checkTenantAdminPerms
+	if err := access.RBAC0DeleteRole(db, roleTenantAdmin); !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("unexpected delete error: %v", err)
 	}
 	if err := access.RBAC0DeleteRole(db, roleTenantUser); err != nil {
 		return err
@@ -1,9 +1,16 @@
 package examples
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/gromitlee/access"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
 )
 
 func TestCasbinRBAC0Controller(t *testing.T) {
@@ -11,13 +18,375 @@ func TestCasbinRBAC0Controller(t *testing.T) {
 	if err := access.InitCasbinRBAC0Controller(db, "casbin_rbac0_model.conf"); err != nil {
 		t.Fatal(err)
 	}
+	if err := checkCasbinModels(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkMatcherFunctions(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCacheMatcher(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCasbinExt(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCasbinMigration(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCasbinTransaction(db); err != nil {
+		t.Fatal(err)
+	}
 	if err := createRolesAndAddPerms(db); err != nil {
 		t.Fatal(err)
 	}
+	if err := checkUserRoles(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSessions(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoleInheritance(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSSD(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDSD(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDomains(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWildcards(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDenyRules(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPermExpiry(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPermConds(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCache(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkWatcher(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDecisions(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkExplain(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAuditLogs(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDecisionLog(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTransaction(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkErrors(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRoleQuery(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkRolePages(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPolicyFiles(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPolicyPlan(db); err != nil {
+		t.Fatal(err)
+	}
 	if err := checkTenantAdminPerms(db); err != nil {
 		t.Fatal(err)
 	}
 	if err := deleteRoles(db); err != nil {
 		t.Fatal(err)
 	}
+	if err := checkLifecycle(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkCasbinModels(db *gorm.DB) error {
+	ctx := context.Background()
+	for _, newCtl := range []func() (access.IRBAC0Controller, error){
+		func() (access.IRBAC0Controller, error) {
+			return access.NewCasbinRBAC0Controller(db, "")
+		},
+		func() (access.IRBAC0Controller, error) {
+			return access.NewCasbinRBAC0ControllerFromString(db, access.CasbinRBAC0Model)
+		},
+		func() (access.IRBAC0Controller, error) {
+			return access.NewCasbinRBAC0ControllerFromFS(db, os.DirFS("."), "casbin_rbac0_model.conf")
+		},
+	} {
+		ctl, err := newCtl()
+		if err != nil {
+			return err
+		}
+		if err = ctl.Close(ctx); err != nil {
+			return err
+		}
+	}
+	// policy without eft/ext is incompatible
+	text := strings.Replace(access.CasbinRBAC0Model, "p = sub, dom, obj, act, eft, ext", "p = sub, dom, obj, act", 1)
+	if _, err := access.NewCasbinRBAC0ControllerFromString(db, text); err == nil {
+		return errors.New("incompatible model accepted")
+	}
+	return nil
+}
+
+func checkMatcherFunctions(db *gorm.DB) error {
+	const roleDocReader perm.Role = 50
+	// obj matched by regexp, act matched case-insensitively by a registered function
+	text := strings.Replace(access.CasbinRBAC0Model, "keyMatch(r.obj, p.obj) && keyMatch(r.act, p.act)",
+		"regexMatch(r.obj, p.obj) && actMatch(r.act, p.act)", 1)
+	ctl, err := access.NewCasbinRBAC0ControllerFromString(db, text)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	defer ctl.Close(ctx)
+	if _, err = ctl.CreateRole(ctx, perm.GlobalDomain, roleDocReader, 0, "role_doc_reader", "", false,
+		perm.Perm{Obj: "^doc/[0-9]+$", Act: "read"}); err != nil {
+		return err
+	}
+	if _, _, _, err = ctl.CheckPerm(ctx, perm.GlobalDomain, roleDocReader, "doc/1", "READ"); err == nil {
+		return errors.New("unregistered matcher function accepted")
+	}
+	if err = ctl.AddMatcherFunction("actMatch", func(args ...interface{}) (interface{}, error) {
+		return strings.EqualFold(args[0].(string), args[1].(string)), nil
+	}); err != nil {
+		return err
+	}
+	if err = ctl.AddMatcherFunction("actMatch", func(args ...interface{}) (interface{}, error) {
+		return true, nil
+	}); err == nil {
+		return errors.New("duplicate matcher function accepted")
+	}
+	if ok, _, _, err := ctl.CheckPerm(ctx, perm.GlobalDomain, roleDocReader, "doc/1", "READ"); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("custom matcher not effective")
+	}
+	if ok, _, _, err := ctl.CheckPerm(ctx, perm.GlobalDomain, roleDocReader, "doc/x", "read"); err != nil {
+		return err
+	} else if ok {
+		return errors.New("custom matcher not effective")
+	}
+	return ctl.DeleteRole(ctx, roleDocReader)
+}
+
+func checkCacheMatcher(db *gorm.DB) error {
+	const roleDocEditor perm.Role = 51
+	ctx := context.Background()
+	// the cache evaluates with perm.Perm.Applies and must not be used with a custom matcher
+	builtin, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer builtin.Close(ctx)
+	if err = access.NewCachedRBAC0Controller(builtin).AddMatcherFunction("actMatch", func(args ...interface{}) (interface{}, error) {
+		return true, nil
+	}); err == nil {
+		return errors.New("matcher function accepted by cache")
+	}
+	text := strings.Replace(access.CasbinRBAC0Model, "keyMatch(r.obj, p.obj) && keyMatch(r.act, p.act)",
+		"regexMatch(r.obj, p.obj) && actMatch(r.act, p.act)", 1)
+	ctl, err := access.NewCasbinRBAC0ControllerFromString(db, text)
+	if err != nil {
+		return err
+	}
+	defer ctl.Close(ctx)
+	cached := access.NewCachedRBAC0Controller(ctl)
+	if err = cached.AddMatcherFunction("actMatch", func(args ...interface{}) (interface{}, error) {
+		return strings.EqualFold(args[0].(string), args[1].(string)), nil
+	}); err != nil {
+		return err
+	}
+	if _, err = cached.CreateRole(ctx, perm.GlobalDomain, roleDocEditor, 0, "role_doc_editor", "", false,
+		perm.Perm{Obj: "^doc/[0-9]+$", Act: "read"},
+		perm.Perm{Obj: "^doc/1[0-9]*$", Act: "write"}); err != nil {
+		return err
+	}
+	for _, req := range []struct {
+		obj perm.Obj
+		act perm.Act
+	}{
+		{"doc/1", "READ"},
+		{"doc/1", "read"},
+		{"doc/x", "read"},
+		{"doc/12", "Write"},
+		{"doc/2", "write"},
+		{"^doc/[0-9]+$", "read"},
+	} {
+		for i := 0; i < 2; i++ {
+			want, _, _, err := ctl.CheckPerm(ctx, perm.GlobalDomain, roleDocEditor, req.obj, req.act)
+			if err != nil {
+				return err
+			}
+			got, _, _, err := cached.CheckPerm(ctx, perm.GlobalDomain, roleDocEditor, req.obj, req.act)
+			if err != nil {
+				return err
+			}
+			if got != want {
+				return fmt.Errorf("cached check %s %s = %v, want %v", req.obj, req.act, got, want)
+			}
+			if got, err = cached.CheckPerms(ctx, perm.GlobalDomain, []perm.Role{roleDocEditor}, req.obj, req.act); err != nil {
+				return err
+			} else if got != want {
+				return fmt.Errorf("cached checks %s %s = %v, want %v", req.obj, req.act, got, want)
+			}
+		}
+	}
+	if stats := cached.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		return fmt.Errorf("custom matcher cached: %+v", stats)
+	}
+	return cached.DeleteRole(ctx, roleDocEditor)
+}
+
+func checkCasbinExt(db *gorm.DB) error {
+	const roleInvoiceApprover perm.Role = 52
+	ctx := context.Background()
+	ctl, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer ctl.Close(ctx)
+	if _, err = ctl.CreateRole(ctx, perm.GlobalDomain, roleInvoiceApprover, 0, "role_invoice_approver", "", false,
+		perm.Perm{Obj: "invoice", Act: "approve", Cond: "amount < 10000"}); err != nil {
+		return err
+	}
+	// the ext column of casbin_rule is 100 characters, longer conditions are rejected instead of truncated
+	longCond := "amount < 10000 && region == 'eu' && department == 'finance' && level >= 3"
+	if err = ctl.GrantRolePerms(ctx, roleInvoiceApprover, []perm.Perm{{Obj: "invoice", Act: "pay", Cond: longCond}}); err == nil {
+		return errors.New("long cond accepted")
+	}
+	if _, err = ctl.CreateRole(ctx, perm.GlobalDomain, roleInvoiceApprover+1, 0, "role_invoice_payer", "", false,
+		perm.Perm{Obj: "invoice", Act: "pay", Cond: longCond}); err == nil {
+		return errors.New("long cond accepted")
+	}
+	// a truncated ext does not turn into an unconditional grant
+	if err = db.Exec("UPDATE casbin_rule SET v5 = ? WHERE ptype = 'p' AND v0 = ?", `{"cond":"amount < 10`, "52").Error; err != nil {
+		return err
+	}
+	reloaded, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer reloaded.Close(ctx)
+	if ok, _, _, err := reloaded.CheckPerm(ctx, perm.GlobalDomain, roleInvoiceApprover, "invoice", "approve"); err != nil {
+		return err
+	} else if ok {
+		return errors.New("truncated ext applied")
+	}
+	if rolePerms, err := reloaded.GetRolePerms(ctx, roleInvoiceApprover); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 0 {
+		return errors.New("truncated ext listed")
+	}
+	return reloaded.DeleteRole(ctx, roleInvoiceApprover)
+}
+
+func checkCasbinMigration(db *gorm.DB) error {
+	const roleLegacyReader perm.Role = 54
+	ctx := context.Background()
+	ctl, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer ctl.Close(ctx)
+	if _, err = ctl.CreateRole(ctx, perm.GlobalDomain, roleLegacyReader, 0, "role_legacy_reader", "", false); err != nil {
+		return err
+	}
+	// policy written by the old model (p = sub, obj, act)
+	if err = db.Exec("INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ('p', '54', 'legacy_obj', 'read', '', '', '')").Error; err != nil {
+		return err
+	}
+	upgraded, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer upgraded.Close(ctx)
+	if ok, _, _, err := upgraded.CheckPerm(ctx, domainTenant1, roleLegacyReader, "legacy_obj", "read"); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("legacy policy not migrated")
+	}
+	if rolePerms, err := upgraded.GetRolePerms(ctx, roleLegacyReader); err != nil {
+		return err
+	} else if len(rolePerms.Perms) != 1 || rolePerms.Perms[0] != (perm.Perm{Obj: "legacy_obj", Act: "read"}) {
+		return fmt.Errorf("unexpected migrated perms %v", rolePerms.Perms)
+	}
+	return upgraded.DeleteRole(ctx, roleLegacyReader)
+}
+
+func checkCasbinTransaction(db *gorm.DB) error {
+	const roleTxEditor perm.Role = 55
+	ctx := context.Background()
+	ctl, err := access.NewCasbinRBAC0Controller(db, "")
+	if err != nil {
+		return err
+	}
+	defer ctl.Close(ctx)
+	p := perm.Perm{Obj: "tx_doc", Act: "edit"}
+	errRollback := errors.New("rollback")
+	check := func(tx *gorm.DB, want bool) error {
+		if ok, _, _, err := ctl.CheckPermTx(tx, perm.GlobalDomain, roleTxEditor, p.Obj, p.Act); err != nil {
+			return err
+		} else if ok != want {
+			return fmt.Errorf("unexpected check result in transaction: %v", ok)
+		}
+		return nil
+	}
+	// changes made after a check in the same transaction are still visible, a nested rollback discards only its own changes
+	if err = ctl.Transaction(ctx, func(tx *gorm.DB) error {
+		if _, err := ctl.CreateRoleTx(tx, perm.GlobalDomain, roleTxEditor, 0, "role_tx_editor", "", false, p); err != nil {
+			return err
+		}
+		if err := check(tx, true); err != nil {
+			return err
+		}
+		if err := ctl.RevokeRolePermsTx(tx, roleTxEditor, []perm.Perm{p}); err != nil {
+			return err
+		}
+		if err := check(tx, false); err != nil {
+			return err
+		}
+		if err := ctl.GrantRolePermsTx(tx, roleTxEditor, []perm.Perm{p}); err != nil {
+			return err
+		}
+		if err := check(tx, true); err != nil {
+			return err
+		}
+		if err := ctl.TransactionTx(tx, func(tx *gorm.DB) error {
+			if err := ctl.RevokeRolePermsTx(tx, roleTxEditor, []perm.Perm{p}); err != nil {
+				return err
+			}
+			if err := check(tx, false); err != nil {
+				return err
+			}
+			return errRollback
+		}); !errors.Is(err, errRollback) {
+			return fmt.Errorf("unexpected nested transaction error: %v", err)
+		}
+		return check(tx, true)
+	}); err != nil {
+		return err
+	}
+	if ok, _, _, err := ctl.CheckPerm(ctx, perm.GlobalDomain, roleTxEditor, p.Obj, p.Act); err != nil {
+		return err
+	} else if !ok {
+		return errors.New("committed grant not effective")
+	}
+	return ctl.DeleteRole(ctx, roleTxEditor)
 }
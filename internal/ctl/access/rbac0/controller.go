@@ -3,83 +3,226 @@ package rbac0
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/gromitlee/access/internal/ctl/rbac0common"
 	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/errs"
 	"github.com/gromitlee/access/pkg/perm"
 	"gorm.io/gorm"
 )
 
 type Controller struct {
+	*rbac0common.Store
+
 	db *gorm.DB
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
 }
 
 func NewController(db *gorm.DB) (*Controller, error) {
 	if err := db.AutoMigrate(
 		model.Role{},
 		model.RolePerm{},
+		model.UserRole{},
+		model.Session{},
+		model.SessionRole{},
+		model.RoleInheritance{},
+		model.SSDSet{},
+		model.SSDSetRole{},
+		model.DSDSet{},
+		model.DSDSetRole{},
+		model.AuditLog{},
 	); err != nil {
 		return nil, err
 	}
-	return &Controller{db: db}, nil
+	ctl := &Controller{db: db, closed: make(chan struct{})}
+	ctl.Store = rbac0common.NewStore(db, ctl)
+	return ctl, nil
+}
+
+func (ctl *Controller) Close(ctx context.Context) error {
+	ctl.closeOnce.Do(func() {
+		go func() {
+			defer close(ctl.closed)
+			if w := ctl.Watcher(); w != nil {
+				ctl.closeErr = w.Close()
+			}
+		}()
+	})
+	select {
+	case <-ctl.closed:
+		return ctl.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (ctl *Controller) Health(ctx context.Context) error {
+	select {
+	case <-ctl.closed:
+		return errs.ErrClosed
+	default:
+	}
+	sqlDB, err := ctl.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (ctl *Controller) AddMatcherFunction(name string, fn func(args ...interface{}) (interface{}, error)) error {
+	return fmt.Errorf("%w: matcher function by access rbac0 controller", errs.ErrNotSupported)
+}
+
+// BuiltinMatcher 权限判定始终与 perm.Perm.Applies 一致
+func (ctl *Controller) BuiltinMatcher() bool {
+	return true
+}
+
+func (ctl *Controller) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return ctl.TransactionTx(ctl.db.WithContext(ctx), fn)
 }
 
-func (ctl *Controller) CheckPerm(ctx context.Context, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
-	return ctl.CheckPermTx(ctl.db.WithContext(ctx), role, obj, act)
+func (ctl *Controller) TransactionTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(fn)
 }
 
-func (ctl *Controller) CheckPermTx(db *gorm.DB, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+func (ctl *Controller) CheckPerm(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return ctl.CheckPermTx(ctl.db.WithContext(ctx), domain, role, obj, act)
+}
+
+func (ctl *Controller) CheckPermTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return ctl.CheckPermWithAttrsTx(db, domain, role, obj, act, nil)
+}
+
+func (ctl *Controller) CheckPermWithAttrs(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	return ctl.CheckPermWithAttrsTx(ctl.db.WithContext(ctx), domain, role, obj, act, attrs)
+}
+
+func (ctl *Controller) CheckPermWithAttrsTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
 	var valid, enable, isAdmin bool
 	if err := db.Transaction(func(tx *gorm.DB) error {
-		dbRole := &model.Role{}
-		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
+		decision, dbRole, err := ctl.checkPerm(tx, domain, role, obj, act, attrs, nil)
+		if err != nil {
 			return err
 		}
 		enable = dbRole.Enable
 		isAdmin = dbRole.IsAdmin
-		if !enable {
-			return nil
-		}
-		if isAdmin {
-			valid = true
-			return nil
+		valid = decision.Allowed
+		return nil
+	}); err != nil {
+		return false, false, false, err
+	}
+	return valid, enable, isAdmin, nil
+}
+
+func (ctl *Controller) CheckPerms(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	return ctl.CheckPermsTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
+}
+
+func (ctl *Controller) CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		return false, err
+	}
+	var decisions []*perm.Decision
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range roles {
+			decision, _, err := ctl.checkPerm(tx, domain, role, obj, act, nil, nil)
+			if err != nil {
+				return err
+			}
+			decisions = append(decisions, decision)
 		}
-		if err := tx.Where("role = ? AND obj = ? AND act = ?", role, obj, act).First(&model.RolePerm{}).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return nil
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return perm.CombineDecisions(decisions).Allowed, nil
+}
+
+func (ctl *Controller) Decide(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideTx(ctl.db.WithContext(ctx), domain, role, obj, act)
+}
+
+func (ctl *Controller) DecideTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideManyTx(db, domain, []perm.Role{role}, obj, act)
+}
+
+func (ctl *Controller) DecideMany(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideManyTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
+}
+
+func (ctl *Controller) DecideManyTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		return nil, err
+	}
+	var decisions []*perm.Decision
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range roles {
+			decision, _, err := ctl.checkPerm(tx, domain, role, obj, act, nil, nil)
+			if errors.Is(err, errs.ErrRoleNotFound) {
+				decision = &perm.Decision{Reason: perm.ReasonRoleNotFound, Role: role}
+			} else if err != nil {
+				return err
 			}
-			return err
+			decisions = append(decisions, decision)
 		}
-		valid = true
 		return nil
 	}); err != nil {
-		return false, false, false, err
+		return nil, err
 	}
-	return valid, enable, isAdmin, nil
+	return perm.CombineDecisions(decisions), nil
 }
 
-func (ctl *Controller) CheckPerms(ctx context.Context, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
-	return ctl.CheckPermsTx(ctl.db.WithContext(ctx), roles, obj, act)
+func (ctl *Controller) Explain(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error) {
+	return ctl.ExplainTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
 }
 
-func (ctl *Controller) CheckPermsTx(db *gorm.DB, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
-	for _, role := range roles {
-		if ok, _, _, err := ctl.CheckPermTx(db, role, obj, act); err != nil {
-			return false, err
-		} else if ok {
-			return true, nil
+func (ctl *Controller) ExplainTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error) {
+	t := &perm.Trace{Domain: domain, Roles: roles, Obj: obj, Act: act}
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		var violation *perm.DSDViolationError
+		if errors.As(err, &violation) {
+			t.AddStep(perm.TraceStepDSD, 0, "%v", err)
 		}
+		return t, err
 	}
-	return false, nil
+	var decisions []*perm.Decision
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		for _, role := range roles {
+			decision, _, err := ctl.checkPerm(tx, domain, role, obj, act, nil, t)
+			if errors.Is(err, errs.ErrRoleNotFound) {
+				decision = &perm.Decision{Reason: perm.ReasonRoleNotFound, Role: role}
+			} else if err != nil {
+				return err
+			}
+			t.AddStep(perm.TraceStepDecision, role, "%s", decision.Reason)
+			decisions = append(decisions, decision)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	t.Decision = perm.CombineDecisions(decisions)
+	t.AddStep(perm.TraceStepDecision, t.Decision.Role, "final: allowed=%v reason=%s", t.Decision.Allowed, t.Decision.Reason)
+	return t, nil
 }
 
-func (ctl *Controller) CreateRole(ctx context.Context, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
-	return ctl.CreateRoleTx(ctl.db.WithContext(ctx), role, creator, name, desc, isAdmin, perms...)
+func (ctl *Controller) CreateRole(ctx context.Context, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+	return ctl.CreateRoleTx(ctl.db.WithContext(ctx), domain, role, creator, name, desc, isAdmin, perms...)
 }
 
-func (ctl *Controller) CreateRoleTx(db *gorm.DB, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+func (ctl *Controller) CreateRoleTx(db *gorm.DB, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
 	var ret *perm.RolePerms
 	dbRole := &model.Role{
 		ID:      int64(role),
+		Domain:  domain,
 		Enable:  true,
 		IsAdmin: isAdmin,
 		Creator: creator,
@@ -87,170 +230,79 @@ func (ctl *Controller) CreateRoleTx(db *gorm.DB, role perm.Role, creator int64,
 		Desc:    desc,
 	}
 	if err := db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(dbRole).Error; err != nil {
+		if err := ctl.CreateRoleRow(tx, dbRole); err != nil {
 			return err
 		}
 		if !isAdmin && len(perms) > 0 {
+			if err := rbac0common.ValidatePerms(perms); err != nil {
+				return err
+			}
+			perms, err := rbac0common.ScopePerms(dbRole, perms)
+			if err != nil {
+				return err
+			}
 			var dbRolePerms []*model.RolePerm
 			for _, p := range perms {
 				dbRolePerms = append(dbRolePerms, &model.RolePerm{
-					Role: perm.Role(dbRole.ID),
-					Obj:  p.Obj,
-					Act:  p.Act,
+					Role:      perm.Role(dbRole.ID),
+					Domain:    p.Domain,
+					Obj:       p.Obj,
+					Act:       p.Act,
+					Effect:    p.Effect,
+					NotBefore: p.NotBefore,
+					ExpiresAt: p.ExpiresAt,
+					Cond:      p.Cond,
 				})
 			}
 			if err := tx.Create(dbRolePerms).Error; err != nil {
 				return err
 			}
 			ret = toRolePerms(dbRole, dbRolePerms)
-			return nil
+		} else {
+			ret = toRolePerms(dbRole, nil)
 		}
-		ret = toRolePerms(dbRole, nil)
-		return nil
+		// 未指定操作用户时记为创建用户
+		actor := audit.ActorFromContext(tx.Statement.Context)
+		if actor == 0 {
+			actor = creator
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Actor: actor, Action: audit.ActionCreateRole, Role: perm.Role(dbRole.ID)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, perm.Role(dbRole.ID))
 	}); err != nil {
 		return nil, err
 	}
 	return ret, nil
 }
 
-func (ctl *Controller) UpdateRole(ctx context.Context, role perm.Role, name, desc string) error {
-	return ctl.UpdateRoleTx(ctl.db.WithContext(ctx), role, name, desc)
-}
-
-func (ctl *Controller) UpdateRoleTx(db *gorm.DB, role perm.Role, name, desc string) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"name": name,
-		"desc": desc,
-	}).Error
-}
-
 func (ctl *Controller) DeleteRole(ctx context.Context, role perm.Role) error {
 	return ctl.DeleteRoleTx(ctl.db.WithContext(ctx), role)
 }
 
 func (ctl *Controller) DeleteRoleTx(db *gorm.DB, role perm.Role) error {
 	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Unscoped().Where("role = ?", role).Delete(&model.RolePerm{}).Error; err != nil {
-			return err
-		}
-		return tx.Unscoped().Where("id = ?", role).Delete(&model.Role{}).Error
-	})
-}
-
-func (ctl *Controller) ListRoleInfo(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
-	return ctl.ListRoleInfoTx(ctl.db.WithContext(ctx), name, enable, offset, limit, order)
-}
-
-func (ctl *Controller) ListRoleInfoTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
-	if offset < 0 || (limit <= 0 && limit != -1) {
-		return nil, 0, errors.New("invalid offset or limit")
-	}
-	var rets []*perm.RoleInfo
-	var count int64
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		var dbRoles []*model.Role
-		_tx := tx
-		if name != "" {
-			_tx = _tx.Where("name LIKE ?", "%"+name+"%")
-		}
-		if enable > 0 {
-			_tx = _tx.Where("enable = ?", true)
-		} else if enable < 0 {
-			_tx = _tx.Where("enable = ?", false)
-		}
-		if order < 0 {
-			_tx = _tx.Order("id desc")
-		}
-		if err := _tx.Model(&model.Role{}).
-			Offset(int(offset)).Limit(int(limit)).Find(&dbRoles).
-			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
 			return err
 		}
-		for _, dbRole := range dbRoles {
-			rets = append(rets, toRoleInfo(dbRole))
+		if before == nil {
+			return rbac0common.RoleErr(gorm.ErrRecordNotFound)
 		}
-		return nil
-	}); err != nil {
-		return nil, 0, err
-	}
-	return rets, count, nil
-}
-
-func (ctl *Controller) GetRoleInfo(ctx context.Context, role perm.Role) (*perm.RoleInfo, error) {
-	return ctl.GetRoleInfoTx(ctl.db.WithContext(ctx), role)
-}
-
-func (ctl *Controller) GetRoleInfoTx(db *gorm.DB, role perm.Role) (*perm.RoleInfo, error) {
-	dbRole := &model.Role{}
-	if err := db.Where("id = ?", role).First(dbRole).Error; err != nil {
-		return nil, err
-	}
-	return toRoleInfo(dbRole), nil
-}
-
-func (ctl *Controller) GetRoleInfos(ctx context.Context, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
-	return ctl.GetRoleInfosTx(ctl.db.WithContext(ctx), roles, order)
-}
-
-func (ctl *Controller) GetRoleInfosTx(db *gorm.DB, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
-	var dbRoles []*model.Role
-	if len(roles) > 0 {
-		db = db.Where("id IN ?", roles)
-	}
-	if order < 0 {
-		db = db.Order("id desc")
-	}
-	if err := db.Model(&model.Role{}).Find(&dbRoles).Error; err != nil {
-		return nil, err
-	}
-	var rets []*perm.RoleInfo
-	for _, dbRole := range dbRoles {
-		rets = append(rets, toRoleInfo(dbRole))
-	}
-	return rets, nil
-}
-
-func (ctl *Controller) ListRolePerms(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
-	return ctl.ListRolePermsTx(ctl.db.WithContext(ctx), name, enable, offset, limit, order)
-}
-
-func (ctl *Controller) ListRolePermsTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
-	if offset < 0 || (limit <= 0 && limit != -1) {
-		return nil, 0, errors.New("invalid offset or limit")
-	}
-	var rets []*perm.RolePerms
-	var count int64
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		var roles []perm.Role
-		_tx := tx
-		if name != "" {
-			_tx = _tx.Where("name LIKE ?", "%"+name+"%")
-		}
-		if enable > 0 {
-			_tx = _tx.Where("enable = ?", true)
-		} else if enable < 0 {
-			_tx = _tx.Where("enable = ?", false)
+		if err := tx.Unscoped().Where("role = ?", role).Delete(&model.RolePerm{}).Error; err != nil {
+			return err
 		}
-		if order < 0 {
-			_tx = _tx.Order("id desc")
+		if err := tx.Unscoped().Where("parent = ? OR child = ?", role, role).Delete(&model.RoleInheritance{}).Error; err != nil {
+			return err
 		}
-		if err := _tx.Model(&model.Role{}).
-			Offset(int(offset)).Limit(int(limit)).Pluck("id", &roles).
-			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+		if err := ctl.DeleteRoleRows(tx, role); err != nil {
 			return err
 		}
-		for _, role := range roles {
-			if ret, err := ctl.GetRolePermsTx(tx, role); err != nil {
-				return err
-			} else {
-				rets = append(rets, ret)
-			}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionDeleteRole, Role: role, Before: before}); err != nil {
+			return err
 		}
-		return nil
-	}); err != nil {
-		return nil, 0, err
-	}
-	return rets, count, nil
+		return ctl.Publish(tx, role)
+	})
 }
 
 func (ctl *Controller) GetRolePerms(ctx context.Context, role perm.Role) (*perm.RolePerms, error) {
@@ -262,13 +314,24 @@ func (ctl *Controller) GetRolePermsTx(db *gorm.DB, role perm.Role) (*perm.RolePe
 	if err := db.Transaction(func(tx *gorm.DB) error {
 		dbRole := &model.Role{}
 		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
-			return err
+			return rbac0common.RoleErr(err)
 		}
 		var dbRolePerms []*model.RolePerm
 		if err := tx.Where("role = ?", role).Find(&dbRolePerms).Error; err != nil {
 			return err
 		}
 		ret = toRolePerms(dbRole, dbRolePerms)
+		roles, err := descendants(tx, role)
+		if err != nil {
+			return err
+		}
+		if len(roles) > 0 {
+			var inheritedPerms []*model.RolePerm
+			if err := tx.Where("role IN ?", roles).Find(&inheritedPerms).Error; err != nil {
+				return err
+			}
+			ret.InheritedPerms = rbac0common.ToInheritedPerms(ret.Perms, toPerms(inheritedPerms))
+		}
 		return nil
 	}); err != nil {
 		return nil, err
@@ -285,7 +348,19 @@ func (ctl *Controller) GrantRolePermsTx(db *gorm.DB, role perm.Role, perms []per
 		return nil
 	}
 	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+		dbRole := &model.Role{}
+		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		if err := rbac0common.ValidatePerms(perms); err != nil {
+			return err
+		}
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
+			return err
+		}
+		perms, err := rbac0common.ScopePerms(dbRole, perms)
+		if err != nil {
 			return err
 		}
 		var dbRolePerms []*model.RolePerm
@@ -296,23 +371,42 @@ func (ctl *Controller) GrantRolePermsTx(db *gorm.DB, role perm.Role, perms []per
 		for _, p := range perms {
 			var exist bool
 			for _, rolePerm := range dbRolePerms {
-				if rolePerm.Obj == p.Obj && rolePerm.Act == p.Act {
+				if rolePerm.Domain == p.Domain && rolePerm.Obj == p.Obj && rolePerm.Act == p.Act && rolePerm.Effect == p.Effect && rolePerm.Cond == p.Cond {
 					exist = true
+					// 重复授予时更新有效期
+					if rolePerm.NotBefore != p.NotBefore || rolePerm.ExpiresAt != p.ExpiresAt {
+						if err := tx.Model(rolePerm).Updates(map[string]interface{}{
+							"not_before": p.NotBefore,
+							"expires_at": p.ExpiresAt,
+						}).Error; err != nil {
+							return err
+						}
+					}
 					break
 				}
 			}
 			if !exist {
 				newRolePerms = append(newRolePerms, &model.RolePerm{
-					Role: role,
-					Obj:  p.Obj,
-					Act:  p.Act,
+					Role:      role,
+					Domain:    p.Domain,
+					Obj:       p.Obj,
+					Act:       p.Act,
+					Effect:    p.Effect,
+					NotBefore: p.NotBefore,
+					ExpiresAt: p.ExpiresAt,
+					Cond:      p.Cond,
 				})
 			}
 		}
 		if len(newRolePerms) > 0 {
-			return tx.Create(newRolePerms).Error
+			if err := tx.Create(newRolePerms).Error; err != nil {
+				return err
+			}
 		}
-		return nil
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionGrantPerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
 	})
 }
 
@@ -325,15 +419,27 @@ func (ctl *Controller) RevokeRolePermsTx(db *gorm.DB, role perm.Role, perms []pe
 		return nil
 	}
 	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+		dbRole := &model.Role{}
+		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
+			return err
+		}
+		perms, err := rbac0common.ScopePerms(dbRole, perms)
+		if err != nil {
 			return err
 		}
 		for _, p := range perms {
-			if err := tx.Where("obj = ? AND act = ?", p.Obj, p.Act).Delete(&model.RolePerm{}).Error; err != nil {
+			if err := tx.Where("role = ? AND domain = ? AND obj = ? AND act = ? AND effect = ? AND cond = ?", role, p.Domain, p.Obj, p.Act, p.Effect, p.Cond).Delete(&model.RolePerm{}).Error; err != nil {
 				return err
 			}
 		}
-		return nil
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionRevokePerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
 	})
 }
 
@@ -343,34 +449,224 @@ func (ctl *Controller) CleanRolePerms(ctx context.Context, role perm.Role) error
 
 func (ctl *Controller) CleanRolePermsTx(db *gorm.DB, role perm.Role) error {
 	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
 			return err
 		}
+		if before == nil {
+			return rbac0common.RoleErr(gorm.ErrRecordNotFound)
+		}
 		if err := tx.Where("role = ?", role).Delete(&model.RolePerm{}).Error; err != nil {
 			return err
 		}
-		return nil
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionCleanPerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
+	})
+}
+
+func (ctl *Controller) SweepExpiredPerms(ctx context.Context) (int64, error) {
+	return ctl.SweepExpiredPermsTx(ctl.db.WithContext(ctx))
+}
+
+func (ctl *Controller) SweepExpiredPermsTx(db *gorm.DB) (int64, error) {
+	var count int64
+	now := time.Now().UnixMilli()
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var roles []perm.Role
+		if err := tx.Model(&model.RolePerm{}).Where("expires_at != 0 AND expires_at <= ?", now).
+			Distinct().Pluck("role", &roles).Error; err != nil {
+			return err
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		befores := make([]*perm.RolePerms, len(roles))
+		for i, role := range roles {
+			before, err := ctl.Snapshot(tx, role)
+			if err != nil {
+				return err
+			}
+			befores[i] = before
+		}
+		ret := tx.Where("role IN ? AND expires_at != 0 AND expires_at <= ?", roles, now).Delete(&model.RolePerm{})
+		if ret.Error != nil {
+			return ret.Error
+		}
+		count = ret.RowsAffected
+		for i, role := range roles {
+			if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionSweepExpiredPerms, Role: role, Before: befores[i]}); err != nil {
+				return err
+			}
+		}
+		return ctl.Publish(tx, roles...)
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (ctl *Controller) AddInheritance(ctx context.Context, parent, child perm.Role) error {
+	return ctl.AddInheritanceTx(ctl.db.WithContext(ctx), parent, child)
+}
+
+func (ctl *Controller) AddInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	if parent == child {
+		return errs.ErrInheritanceCycle
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		dbParent := &model.Role{}
+		if err := tx.Where("id = ?", parent).First(dbParent).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		dbChild := &model.Role{}
+		if err := tx.Where("id = ?", child).First(dbChild).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		if dbChild.Domain != perm.GlobalDomain && dbChild.Domain != dbParent.Domain {
+			return errs.ErrInheritanceAcrossDomains
+		}
+		roles, err := descendants(tx, child)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if role == parent {
+				return errs.ErrInheritanceCycle
+			}
+		}
+		before, err := ctl.Snapshot(tx, parent)
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&model.RoleInheritance{}).Where("parent = ? AND child = ?", parent, child).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := tx.Create(&model.RoleInheritance{
+			Parent: parent,
+			Child:  child,
+		}).Error; err != nil {
+			return err
+		}
+		if err := ctl.CheckRolesSSD(tx, []perm.Role{parent}); err != nil {
+			return err
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionAddInheritance, Role: parent, Before: before, Detail: fmt.Sprintf("child=%d", child)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, parent)
 	})
 }
 
-func (ctl *Controller) EnableRole(ctx context.Context, role perm.Role) error {
-	return ctl.EnableRoleTx(ctl.db.WithContext(ctx), role)
+func (ctl *Controller) DeleteInheritance(ctx context.Context, parent, child perm.Role) error {
+	return ctl.DeleteInheritanceTx(ctl.db.WithContext(ctx), parent, child)
 }
 
-func (ctl *Controller) EnableRoleTx(db *gorm.DB, role perm.Role) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"enable": true,
-	}).Error
+func (ctl *Controller) DeleteInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		before, err := ctl.Snapshot(tx, parent)
+		if err != nil {
+			return err
+		}
+		ret := tx.Where("parent = ? AND child = ?", parent, child).Delete(&model.RoleInheritance{})
+		if ret.Error != nil {
+			return ret.Error
+		}
+		if ret.RowsAffected == 0 {
+			return nil
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionDeleteInheritance, Role: parent, Before: before, Detail: fmt.Sprintf("child=%d", child)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, parent)
+	})
 }
 
-func (ctl *Controller) DisableRole(ctx context.Context, role perm.Role) error {
-	return ctl.DisableRoleTx(ctl.db.WithContext(ctx), role)
+func (ctl *Controller) ListAncestors(ctx context.Context, role perm.Role) ([]perm.Role, error) {
+	return ctl.ListAncestorsTx(ctl.db.WithContext(ctx), role)
 }
 
-func (ctl *Controller) DisableRoleTx(db *gorm.DB, role perm.Role) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"enable": false,
-	}).Error
+func (ctl *Controller) ListAncestorsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	return walkInheritance(db, role, "child", "parent")
+}
+
+func (ctl *Controller) ListDescendants(ctx context.Context, role perm.Role) ([]perm.Role, error) {
+	return ctl.ListDescendantsTx(ctl.db.WithContext(ctx), role)
+}
+
+func (ctl *Controller) ListDescendantsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	return descendants(db, role)
+}
+
+func (ctl *Controller) FilterPermRoles(db *gorm.DB, q *perm.RoleQuery) (*gorm.DB, error) {
+	sub := db.Session(&gorm.Session{NewDB: true}).Model(&model.RolePerm{}).Select("role").
+		Where("obj = ? AND effect = ?", q.Obj, perm.EffectAllow)
+	if q.Act != "" {
+		sub = sub.Where("act = ?", q.Act)
+	}
+	if q.Domain != perm.GlobalDomain {
+		sub = sub.Where("domain IN ?", rbac0common.DomainScope(q.Domain))
+	}
+	return db.Where("id IN (?)", sub), nil
+}
+
+// --- internal method ---
+
+// checkPerm 检查role(含继承角色)在domain中对obj/act的权限，拒绝优先，内置admin不受拒绝权限约束
+// 带条件的权限按attrs求值；角色不存在时返回 errs.ErrRoleNotFound；t不为nil时记录检查过程
+func (ctl *Controller) checkPerm(tx *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}, t *perm.Trace) (*perm.Decision, *model.Role, error) {
+	dbRole := &model.Role{}
+	if err := tx.Where("id = ? AND domain IN ?", role, rbac0common.DomainScope(domain)).First(dbRole).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			t.AddStep(perm.TraceStepRole, role, "role not found in domain %q", domain)
+		}
+		return nil, nil, rbac0common.RoleErr(err)
+	}
+	t.AddStep(perm.TraceStepRole, role, "role found: domain=%q enable=%v admin=%v", dbRole.Domain, dbRole.Enable, dbRole.IsAdmin)
+	if !dbRole.Enable {
+		return &perm.Decision{Reason: perm.ReasonRoleDisabled, Role: role}, dbRole, nil
+	}
+	if dbRole.IsAdmin {
+		return &perm.Decision{Allowed: true, Reason: perm.ReasonAdminBypass, Role: role}, dbRole, nil
+	}
+	roles, err := descendants(tx, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.AddStep(perm.TraceStepInherit, role, "inherits roles %v", roles)
+	roles = append(roles, role)
+	// 精确匹配或模式匹配的候选权限
+	var dbRolePerms []*model.RolePerm
+	if err := tx.Where("role IN ? AND domain IN ?", roles, rbac0common.DomainScope(domain)).
+		Where("obj = ? OR obj LIKE ?", obj, "%"+perm.Wildcard+"%").
+		Where("act = ? OR act LIKE ?", act, "%"+perm.Wildcard+"%").
+		Order("id").Find(&dbRolePerms).Error; err != nil {
+		return nil, nil, err
+	}
+	var allow *perm.Decision
+	now := time.Now().UnixMilli()
+	for _, dbRolePerm := range dbRolePerms {
+		p := toPerms([]*model.RolePerm{dbRolePerm})[0]
+		t.AddGrant(role, dbRolePerm.Role, p, now, attrs)
+		if !p.Applies(obj, act, now, attrs) {
+			continue
+		}
+		if p.Effect == perm.EffectDeny {
+			return &perm.Decision{Reason: perm.ReasonDenied, Role: role, Grant: &p, GrantRole: dbRolePerm.Role}, dbRole, nil
+		}
+		if allow == nil {
+			allow = &perm.Decision{Allowed: true, Reason: perm.ReasonGranted, Role: role, Grant: &p, GrantRole: dbRolePerm.Role}
+		}
+	}
+	if allow != nil {
+		return allow, dbRole, nil
+	}
+	return &perm.Decision{Reason: perm.ReasonNoGrant, Role: role}, dbRole, nil
 }
 
 // --- internal function ---
@@ -378,31 +674,57 @@ func (ctl *Controller) DisableRoleTx(db *gorm.DB, role perm.Role) error {
 func toRolePerms(dbRole *model.Role, perms []*model.RolePerm) *perm.RolePerms {
 	ret := &perm.RolePerms{
 		CreatedAt: dbRole.CreatedAt,
+		Domain:    dbRole.Domain,
 		Role:      perm.Role(dbRole.ID),
 		Enable:    dbRole.Enable,
 		IsAdmin:   dbRole.IsAdmin,
 		Creator:   dbRole.Creator,
 		Name:      dbRole.Name,
 		Desc:      dbRole.Desc,
-		Perms:     nil,
 	}
-	for _, p := range perms {
-		ret.Perms = append(ret.Perms, perm.Perm{
-			Obj: p.Obj,
-			Act: p.Act,
+	ret.Perms = toPerms(perms)
+	return ret
+}
+
+func toPerms(dbRolePerms []*model.RolePerm) []perm.Perm {
+	var perms []perm.Perm
+	for _, p := range dbRolePerms {
+		perms = append(perms, perm.Perm{
+			Domain:    p.Domain,
+			Obj:       p.Obj,
+			Act:       p.Act,
+			Effect:    p.Effect,
+			NotBefore: p.NotBefore,
+			ExpiresAt: p.ExpiresAt,
+			Cond:      p.Cond,
 		})
 	}
-	return ret
+	return perms
 }
 
-func toRoleInfo(dbRole *model.Role) *perm.RoleInfo {
-	return &perm.RoleInfo{
-		CreatedAt: dbRole.CreatedAt,
-		Role:      perm.Role(dbRole.ID),
-		Enable:    dbRole.Enable,
-		IsAdmin:   dbRole.IsAdmin,
-		Creator:   dbRole.Creator,
-		Name:      dbRole.Name,
-		Desc:      dbRole.Desc,
+// descendants 查询role直接或间接继承的所有角色(不含role自身)
+func descendants(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	return walkInheritance(db, role, "parent", "child")
+}
+
+// walkInheritance 沿继承关系(from -> to)广度优先遍历，返回除role自身以外的所有可达角色
+func walkInheritance(db *gorm.DB, role perm.Role, from, to string) ([]perm.Role, error) {
+	var rets []perm.Role
+	visited := map[perm.Role]bool{role: true}
+	queue := []perm.Role{role}
+	for len(queue) > 0 {
+		var next []perm.Role
+		if err := db.Model(&model.RoleInheritance{}).Where(from+" IN ?", queue).Pluck(to, &next).Error; err != nil {
+			return nil, err
+		}
+		queue = nil
+		for _, r := range next {
+			if !visited[r] {
+				visited[r] = true
+				rets = append(rets, r)
+				queue = append(queue, r)
+			}
+		}
 	}
+	return rets, nil
 }
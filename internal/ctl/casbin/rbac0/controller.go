@@ -2,259 +2,376 @@ package rbac0
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/casbin/casbin/v2"
+	casbinmodel "github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/casbin/govaluate"
+	"github.com/gromitlee/access/internal/ctl/rbac0common"
 	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/errs"
 	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
 	"gorm.io/gorm"
 )
 
 const (
-	autoLoadInterval = time.Second * 3
+	// 默认Watcher(数据库轮询)的轮询间隔
+	defaultWatchInterval = time.Second * 3
+	// 全局域在casbin policy中的表示
+	casbinGlobalDom = "*"
+	// 权限效果在casbin policy中的表示
+	casbinEftAllow = "allow"
+	casbinEftDeny  = "deny"
+	// policy中扩展字段的下标，扩展字段为JSON编码的 casbinExt
+	casbinExtIndex = 5
+	// 扩展字段的最大长度，与 gormadapter.CasbinRule 的v5列一致
+	casbinExtSize = 100
+	// 角色继承的最大层数，casbin默认为10，更深的继承不生效；access控制器不限制层数
+	// AddInheritance 拒绝循环继承，因此实际层数不超过角色数
+	casbinMaxHierarchyLevel = 1 << 16
 )
 
+// casbinExt policy扩展字段
+type casbinExt struct {
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	Cond      string `json:"cond,omitempty"`
+}
+
 type Controller struct {
+	*rbac0common.Store
+
 	db *gorm.DB
-	e  casbin.IEnforcer
+	// 不含policy的model，用于创建临时enforcer
+	m casbinmodel.Model
+	e casbin.IDistributedEnforcer
+	// matcher与policy effect是否与 DefaultModel 一致
+	builtin bool
+
+	// 已注册的matcher函数
+	fnsMu sync.RWMutex
+	fns   map[string]govaluate.ExpressionFunction
+
+	// 取消订阅当前Watcher
+	subMu       sync.Mutex
+	unsubscribe func()
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
 }
 
-func NewController(db *gorm.DB, modelPath string) (*Controller, error) {
-	if err := db.AutoMigrate(model.Role{}); err != nil {
+// NewController m须与 DefaultModel 兼容，m被复制后使用
+// 旧版本model(p = sub, obj, act)写入的policy在加载前改写为全局域的允许权限，见 migrateLegacyPolicy
+func NewController(db *gorm.DB, m casbinmodel.Model) (*Controller, error) {
+	if err := validateModel(m); err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(
+		model.Role{},
+		model.UserRole{},
+		model.Session{},
+		model.SessionRole{},
+		model.SSDSet{},
+		model.SSDSetRole{},
+		model.DSDSet{},
+		model.DSDSetRole{},
+		model.AuditLog{},
+	); err != nil {
 		return nil, err
 	}
 	a, err := gormadapter.NewAdapterByDB(db)
 	if err != nil {
 		return nil, err
 	}
-	e, err := casbin.NewDistributedEnforcer(modelPath, a)
+	if err := migrateLegacyPolicy(db); err != nil {
+		return nil, err
+	}
+	e, err := casbin.NewDistributedEnforcer(m.Copy(), a)
 	if err != nil {
 		return nil, err
 	}
-	e.StartAutoLoadPolicy(autoLoadInterval)
-	return &Controller{db: db, e: e}, nil
+	// 加载policy时使用默认的role manager，替换后重建继承关系
+	e.SetRoleManager(newRoleManager())
+	if err := e.BuildRoleLinks(); err != nil {
+		return nil, err
+	}
+	ctl := &Controller{
+		db:      db,
+		m:       m.Copy(),
+		e:       e,
+		builtin: builtinModel(m),
+		fns:     make(map[string]govaluate.ExpressionFunction),
+		closed:  make(chan struct{}),
+	}
+	ctl.Store = rbac0common.NewStore(db, ctl)
+	ctl.addFunctions(e)
+	// 默认通过数据库轮询接收其他实例的变更，可通过 SetWatcher 替换
+	w, err := watcher.NewDBWatcher(db, defaultWatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	ctl.SetWatcher(w)
+	return ctl, nil
 }
 
-func (ctl *Controller) CheckPerm(ctx context.Context, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
-	return ctl.CheckPermTx(ctl.db.WithContext(ctx), role, obj, act)
+// SetWatcher 替换Watcher(默认为数据库轮询)，之前的Watcher被关闭，收到变更时重新加载policy
+func (ctl *Controller) SetWatcher(w watcher.Watcher) {
+	ctl.subMu.Lock()
+	defer ctl.subMu.Unlock()
+	if ctl.unsubscribe != nil {
+		ctl.unsubscribe()
+	}
+	ctl.Store.SetWatcher(w)
+	ctl.unsubscribe = w.Subscribe(func(watcher.Event) {
+		select {
+		case <-ctl.closed:
+			return
+		default:
+		}
+		// 加载失败时等待下次变更
+		_ = ctl.e.LoadPolicy()
+	})
 }
 
-func (ctl *Controller) CheckPermTx(db *gorm.DB, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
-	dbRole := &model.Role{}
-	var enable, isAdmin bool
-	if err := db.Where("id = ?", role).First(dbRole).Error; err != nil {
-		return false, false, false, err
+// Close 取消订阅并关闭Watcher，等待正在进行的policy加载结束
+func (ctl *Controller) Close(ctx context.Context) error {
+	ctl.closeOnce.Do(func() {
+		go func() {
+			defer close(ctl.closed)
+			ctl.subMu.Lock()
+			if ctl.unsubscribe != nil {
+				ctl.unsubscribe()
+				ctl.unsubscribe = nil
+			}
+			ctl.subMu.Unlock()
+			if w := ctl.Watcher(); w != nil {
+				ctl.closeErr = w.Close()
+			}
+		}()
+	})
+	select {
+	case <-ctl.closed:
+		return ctl.closeErr
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	enable = dbRole.Enable
-	isAdmin = dbRole.IsAdmin
-	if !enable {
-		return false, enable, isAdmin, nil
+}
+
+func (ctl *Controller) Health(ctx context.Context) error {
+	select {
+	case <-ctl.closed:
+		return errs.ErrClosed
+	default:
 	}
-	if isAdmin {
-		return true, enable, isAdmin, nil
+	sqlDB, err := ctl.db.DB()
+	if err != nil {
+		return err
 	}
-	ok, err := ctl.e.HasPolicy(role2CasbinSub(role), string(obj), string(act))
+	return sqlDB.PingContext(ctx)
+}
+
+func (ctl *Controller) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return ctl.TransactionTx(ctl.db.WithContext(ctx), fn)
+}
+
+func (ctl *Controller) TransactionTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return ctl.transaction(db, func(tx *gorm.DB, _ *casbinTx) error {
+		return fn(tx)
+	})
+}
+
+func (ctl *Controller) CheckPerm(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return ctl.CheckPermTx(ctl.db.WithContext(ctx), domain, role, obj, act)
+}
+
+func (ctl *Controller) CheckPermTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return ctl.CheckPermWithAttrsTx(db, domain, role, obj, act, nil)
+}
+
+func (ctl *Controller) CheckPermWithAttrs(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	return ctl.CheckPermWithAttrsTx(ctl.db.WithContext(ctx), domain, role, obj, act, attrs)
+}
+
+func (ctl *Controller) CheckPermWithAttrsTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	decision, dbRole, err := ctl.checkPerm(db, domain, role, obj, act, attrs, nil)
 	if err != nil {
 		return false, false, false, err
 	}
-	return ok, enable, isAdmin, nil
+	return decision.Allowed, dbRole.Enable, dbRole.IsAdmin, nil
 }
 
-func (ctl *Controller) CheckPerms(ctx context.Context, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
-	return ctl.CheckPermsTx(ctl.db.WithContext(ctx), roles, obj, act)
+func (ctl *Controller) CheckPerms(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	return ctl.CheckPermsTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
 }
 
-func (ctl *Controller) CheckPermsTx(db *gorm.DB, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+func (ctl *Controller) CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		return false, err
+	}
+	var decisions []*perm.Decision
 	for _, role := range roles {
-		if ok, _, _, err := ctl.CheckPermTx(db, role, obj, act); err != nil {
+		decision, _, err := ctl.checkPerm(db, domain, role, obj, act, nil, nil)
+		if err != nil {
 			return false, err
-		} else if ok {
-			return true, nil
 		}
+		decisions = append(decisions, decision)
 	}
-	return false, nil
+	return perm.CombineDecisions(decisions).Allowed, nil
+}
+
+func (ctl *Controller) Decide(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideTx(ctl.db.WithContext(ctx), domain, role, obj, act)
 }
 
-func (ctl *Controller) CreateRole(ctx context.Context, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
-	return ctl.CreateRoleTx(ctl.db.WithContext(ctx), role, creator, name, desc, isAdmin, perms...)
+func (ctl *Controller) DecideTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideManyTx(db, domain, []perm.Role{role}, obj, act)
+}
+
+func (ctl *Controller) DecideMany(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	return ctl.DecideManyTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
+}
+
+func (ctl *Controller) DecideManyTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		return nil, err
+	}
+	var decisions []*perm.Decision
+	for _, role := range roles {
+		decision, _, err := ctl.checkPerm(db, domain, role, obj, act, nil, nil)
+		if errors.Is(err, errs.ErrRoleNotFound) {
+			decision = &perm.Decision{Reason: perm.ReasonRoleNotFound, Role: role}
+		} else if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, decision)
+	}
+	return perm.CombineDecisions(decisions), nil
+}
+
+func (ctl *Controller) Explain(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error) {
+	return ctl.ExplainTx(ctl.db.WithContext(ctx), domain, roles, obj, act)
+}
+
+func (ctl *Controller) ExplainTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error) {
+	t := &perm.Trace{Domain: domain, Roles: roles, Obj: obj, Act: act}
+	if err := ctl.CheckDSD(db, roles); err != nil {
+		var violation *perm.DSDViolationError
+		if errors.As(err, &violation) {
+			t.AddStep(perm.TraceStepDSD, 0, "%v", err)
+		}
+		return t, err
+	}
+	var decisions []*perm.Decision
+	for _, role := range roles {
+		decision, _, err := ctl.checkPerm(db, domain, role, obj, act, nil, t)
+		if errors.Is(err, errs.ErrRoleNotFound) {
+			decision = &perm.Decision{Reason: perm.ReasonRoleNotFound, Role: role}
+		} else if err != nil {
+			return nil, err
+		}
+		t.AddStep(perm.TraceStepDecision, role, "%s", decision.Reason)
+		decisions = append(decisions, decision)
+	}
+	t.Decision = perm.CombineDecisions(decisions)
+	t.AddStep(perm.TraceStepDecision, t.Decision.Role, "final: allowed=%v reason=%s", t.Decision.Allowed, t.Decision.Reason)
+	return t, nil
 }
 
-func (ctl *Controller) CreateRoleTx(db *gorm.DB, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+func (ctl *Controller) CreateRole(ctx context.Context, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+	return ctl.CreateRoleTx(ctl.db.WithContext(ctx), domain, role, creator, name, desc, isAdmin, perms...)
+}
+
+func (ctl *Controller) CreateRoleTx(db *gorm.DB, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
 	var ret *perm.RolePerms
 	dbRole := &model.Role{
 		ID:      int64(role),
+		Domain:  domain,
 		Enable:  true,
 		IsAdmin: isAdmin,
 		Creator: creator,
 		Name:    name,
 		Desc:    desc,
 	}
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(dbRole).Error; err != nil {
+	if err := ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		if err := ctl.CreateRoleRow(tx, dbRole); err != nil {
 			return err
 		}
 		if !isAdmin && len(perms) > 0 {
-			if _, err := ctl.e.AddPolicies(perms2CasbinRules(roleID2CasbinSub(dbRole.ID), perms)); err != nil {
+			if err := validatePerms(perms); err != nil {
 				return err
 			}
-			if rolePerm, err := ctl.toRolePerms(dbRole); err != nil {
+			perms, err := rbac0common.ScopePerms(dbRole, perms)
+			if err != nil {
+				return err
+			}
+			if err := ptx.AddPolicies(perms2CasbinRules(roleID2CasbinSub(dbRole.ID), perms)); err != nil {
 				return err
-			} else {
-				ret = rolePerm
 			}
 		}
-		return nil
+		if rolePerm, err := ctl.toRolePerms(ptx, dbRole); err != nil {
+			return err
+		} else {
+			ret = rolePerm
+		}
+		// 未指定操作用户时记为创建用户
+		actor := audit.ActorFromContext(tx.Statement.Context)
+		if actor == 0 {
+			actor = creator
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Actor: actor, Action: audit.ActionCreateRole, Role: perm.Role(dbRole.ID)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, perm.Role(dbRole.ID))
 	}); err != nil {
 		return nil, err
 	}
 	return ret, nil
 }
 
-func (ctl *Controller) UpdateRole(ctx context.Context, role perm.Role, name, desc string) error {
-	return ctl.UpdateRoleTx(ctl.db.WithContext(ctx), role, name, desc)
-}
-
-func (ctl *Controller) UpdateRoleTx(db *gorm.DB, role perm.Role, name, desc string) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"name": name,
-		"desc": desc,
-	}).Error
-}
-
 func (ctl *Controller) DeleteRole(ctx context.Context, role perm.Role) error {
 	return ctl.DeleteRoleTx(ctl.db.WithContext(ctx), role)
 }
 
 func (ctl *Controller) DeleteRoleTx(db *gorm.DB, role perm.Role) error {
-	return db.Transaction(func(tx *gorm.DB) error {
-		rules, err := ctl.e.GetPermissionsForUser(role2CasbinSub(role))
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		before, err := ctl.Snapshot(tx, role)
 		if err != nil {
 			return err
 		}
-		if _, err := ctl.e.RemovePolicies(rules); err != nil {
-			return err
+		if before == nil {
+			return rbac0common.RoleErr(gorm.ErrRecordNotFound)
 		}
-		return tx.Unscoped().Where("id = ?", role).Delete(&model.Role{}).Error
-	})
-}
-
-func (ctl *Controller) ListRoleInfo(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
-	return ctl.ListRoleInfoTx(ctl.db.WithContext(ctx), name, enable, offset, limit, order)
-}
-
-func (ctl *Controller) ListRoleInfoTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
-	if offset < 0 || (limit <= 0 && limit != -1) {
-		return nil, 0, errors.New("invalid offset or limit")
-	}
-	var rets []*perm.RoleInfo
-	var count int64
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		var dbRoles []*model.Role
-		_tx := tx
-		if name != "" {
-			_tx = _tx.Where("name LIKE ?", "%"+name+"%")
-		}
-		if enable > 0 {
-			_tx = _tx.Where("enable = ?", true)
-		} else if enable < 0 {
-			_tx = _tx.Where("enable = ?", false)
-		}
-		if order < 0 {
-			_tx = _tx.Order("id desc")
-		}
-		if err := _tx.Model(&model.Role{}).
-			Offset(int(offset)).Limit(int(limit)).Find(&dbRoles).
-			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+		rules, err := ptx.GetFilteredPolicy(0, role2CasbinSub(role))
+		if err != nil {
 			return err
 		}
-		for _, dbRole := range dbRoles {
-			rets = append(rets, toRoleInfo(dbRole))
-		}
-		return nil
-	}); err != nil {
-		return nil, 0, err
-	}
-	return rets, count, nil
-}
-
-func (ctl *Controller) GetRoleInfo(ctx context.Context, role perm.Role) (*perm.RoleInfo, error) {
-	return ctl.GetRoleInfoTx(ctl.db.WithContext(ctx), role)
-}
-
-func (ctl *Controller) GetRoleInfoTx(db *gorm.DB, role perm.Role) (*perm.RoleInfo, error) {
-	dbRole := &model.Role{}
-	if err := db.Where("id = ?", role).First(dbRole).Error; err != nil {
-		return nil, err
-	}
-	return toRoleInfo(dbRole), nil
-}
-
-func (ctl *Controller) GetRoleInfos(ctx context.Context, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
-	return ctl.GetRoleInfosTx(ctl.db.WithContext(ctx), roles, order)
-}
-
-func (ctl *Controller) GetRoleInfosTx(db *gorm.DB, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
-	var dbRoles []*model.Role
-	if len(roles) > 0 {
-		db = db.Where("id IN ?", roles)
-	}
-	if order < 0 {
-		db = db.Order("id desc")
-	}
-	if err := db.Model(&model.Role{}).Find(&dbRoles).Error; err != nil {
-		return nil, err
-	}
-	var rets []*perm.RoleInfo
-	for _, dbRole := range dbRoles {
-		rets = append(rets, toRoleInfo(dbRole))
-	}
-	return rets, nil
-}
-
-func (ctl *Controller) ListRolePerms(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
-	return ctl.ListRolePermsTx(ctl.db.WithContext(ctx), name, enable, offset, limit, order)
-}
-
-func (ctl *Controller) ListRolePermsTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
-	if offset < 0 || limit <= 0 {
-		return nil, 0, errors.New("invalid offset or limit")
-	}
-	var rets []*perm.RolePerms
-	var count int64
-	if err := db.Transaction(func(tx *gorm.DB) error {
-		var roles []perm.Role
-		_tx := tx
-		if name != "" {
-			_tx = _tx.Where("name LIKE ?", "%"+name+"%")
+		if err := ptx.RemovePolicies(rules); err != nil {
+			return err
 		}
-		if enable > 0 {
-			_tx = _tx.Where("enable = ?", true)
-		} else if enable < 0 {
-			_tx = _tx.Where("enable = ?", false)
+		if err := ptx.RemoveFilteredGroupingPolicy(0, role2CasbinSub(role)); err != nil {
+			return err
 		}
-		if order < 0 {
-			_tx = _tx.Order("id desc")
+		if err := ptx.RemoveFilteredGroupingPolicy(1, role2CasbinSub(role)); err != nil {
+			return err
 		}
-		if err := _tx.Model(&model.Role{}).
-			Offset(int(offset)).Limit(int(limit)).Pluck("id", &roles).
-			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+		if err := ctl.DeleteRoleRows(tx, role); err != nil {
 			return err
 		}
-		for _, role := range roles {
-			if ret, err := ctl.GetRolePermsTx(tx, role); err != nil {
-				return err
-			} else {
-				rets = append(rets, ret)
-			}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionDeleteRole, Role: role, Before: before}); err != nil {
+			return err
 		}
-		return nil
-	}); err != nil {
-		return nil, 0, err
-	}
-	return rets, count, nil
+		return ctl.Publish(tx, role)
+	})
 }
 
 func (ctl *Controller) GetRolePerms(ctx context.Context, role perm.Role) (*perm.RolePerms, error) {
@@ -264,9 +381,9 @@ func (ctl *Controller) GetRolePerms(ctx context.Context, role perm.Role) (*perm.
 func (ctl *Controller) GetRolePermsTx(db *gorm.DB, role perm.Role) (*perm.RolePerms, error) {
 	dbRole := &model.Role{}
 	if err := db.Where("id = ?", role).First(dbRole).Error; err != nil {
-		return nil, err
+		return nil, rbac0common.RoleErr(err)
 	}
-	return ctl.toRolePerms(dbRole)
+	return ctl.toRolePerms(ctl.policy(db), dbRole)
 }
 
 func (ctl *Controller) GrantRolePerms(ctx context.Context, role perm.Role, perms []perm.Perm) error {
@@ -277,14 +394,45 @@ func (ctl *Controller) GrantRolePermsTx(db *gorm.DB, role perm.Role, perms []per
 	if len(perms) == 0 {
 		return nil
 	}
-	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		dbRole := &model.Role{}
+		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		if err := validatePerms(perms); err != nil {
 			return err
 		}
-		if _, err := ctl.e.AddPoliciesEx(perms2CasbinRules(role2CasbinSub(role), perms)); err != nil {
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
 			return err
 		}
-		return nil
+		perms, err := rbac0common.ScopePerms(dbRole, perms)
+		if err != nil {
+			return err
+		}
+		var newRules [][]string
+		for _, p := range perms {
+			rule := perm2CasbinRule(role2CasbinSub(role), p)
+			// 重复授予时更新有效期
+			oldRules, err := samePermRules(ptx, rule)
+			if err != nil {
+				return err
+			}
+			if len(oldRules) == 1 && util.ArrayEquals(oldRules[0], rule) {
+				continue
+			}
+			if err := ptx.RemovePolicies(oldRules); err != nil {
+				return err
+			}
+			newRules = append(newRules, rule)
+		}
+		if err := ptx.AddPolicies(newRules); err != nil {
+			return err
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionGrantPerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
 	})
 }
 
@@ -296,14 +444,35 @@ func (ctl *Controller) RevokeRolePermsTx(db *gorm.DB, role perm.Role, perms []pe
 	if len(perms) == 0 {
 		return nil
 	}
-	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		dbRole := &model.Role{}
+		if err := tx.Where("id = ?", role).First(dbRole).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
 			return err
 		}
-		if _, err := ctl.e.RemovePolicies(perms2CasbinRules(role2CasbinSub(role), perms)); err != nil {
+		perms, err := rbac0common.ScopePerms(dbRole, perms)
+		if err != nil {
 			return err
 		}
-		return nil
+		// 不区分有效期
+		var oldRules [][]string
+		for _, rule := range perms2CasbinRules(role2CasbinSub(role), perms) {
+			rules, err := samePermRules(ptx, rule)
+			if err != nil {
+				return err
+			}
+			oldRules = append(oldRules, rules...)
+		}
+		if err := ptx.RemovePolicies(oldRules); err != nil {
+			return err
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionRevokePerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
 	})
 }
 
@@ -312,76 +481,360 @@ func (ctl *Controller) CleanRolePerms(ctx context.Context, role perm.Role) error
 }
 
 func (ctl *Controller) CleanRolePermsTx(db *gorm.DB, role perm.Role) error {
-	return db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
-			return err
-		}
+	if ctl.policyTx(db) == nil {
 		if err := ctl.e.LoadPolicy(); err != nil {
 			// db同步一下policy
 			return err
 		}
-		rules, err := ctl.e.GetPermissionsForUser(role2CasbinSub(role))
+	}
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		before, err := ctl.Snapshot(tx, role)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return rbac0common.RoleErr(gorm.ErrRecordNotFound)
+		}
+		rules, err := ptx.GetFilteredPolicy(0, role2CasbinSub(role))
 		if err != nil {
 			return err
 		}
-		if _, err := ctl.e.RemovePolicies(rules); err != nil {
+		if err := ptx.RemovePolicies(rules); err != nil {
 			return err
 		}
-		return nil
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionCleanPerms, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, role)
 	})
 }
 
-func (ctl *Controller) EnableRole(ctx context.Context, role perm.Role) error {
-	return ctl.EnableRoleTx(ctl.db.WithContext(ctx), role)
+func (ctl *Controller) SweepExpiredPerms(ctx context.Context) (int64, error) {
+	return ctl.SweepExpiredPermsTx(ctl.db.WithContext(ctx))
 }
 
-func (ctl *Controller) EnableRoleTx(db *gorm.DB, role perm.Role) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"enable": true,
-	}).Error
+func (ctl *Controller) SweepExpiredPermsTx(db *gorm.DB) (int64, error) {
+	var count int64
+	if err := ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		rules, err := ptx.GetFilteredPolicy(0)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		var expiredRules [][]string
+		for _, rule := range rules {
+			if ruleExpired(rule, now) {
+				expiredRules = append(expiredRules, rule)
+			}
+		}
+		if len(expiredRules) == 0 {
+			return nil
+		}
+		roles := rbac0common.UniqueRoles(casbinSubs2Roles(ruleSubs(expiredRules)))
+		befores := make([]*perm.RolePerms, len(roles))
+		for i, role := range roles {
+			before, err := ctl.Snapshot(tx, role)
+			if err != nil {
+				return err
+			}
+			befores[i] = before
+		}
+		if err := ptx.RemovePolicies(expiredRules); err != nil {
+			return err
+		}
+		for i, role := range roles {
+			if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionSweepExpiredPerms, Role: role, Before: befores[i]}); err != nil {
+				return err
+			}
+		}
+		count = int64(len(expiredRules))
+		return ctl.Publish(tx, roles...)
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (ctl *Controller) AddInheritance(ctx context.Context, parent, child perm.Role) error {
+	return ctl.AddInheritanceTx(ctl.db.WithContext(ctx), parent, child)
 }
 
-func (ctl *Controller) DisableRole(ctx context.Context, role perm.Role) error {
-	return ctl.DisableRoleTx(ctl.db.WithContext(ctx), role)
+func (ctl *Controller) AddInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	if parent == child {
+		return errs.ErrInheritanceCycle
+	}
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		dbParent := &model.Role{}
+		if err := tx.Where("id = ?", parent).First(dbParent).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		dbChild := &model.Role{}
+		if err := tx.Where("id = ?", child).First(dbChild).Error; err != nil {
+			return rbac0common.RoleErr(err)
+		}
+		if dbChild.Domain != perm.GlobalDomain && dbChild.Domain != dbParent.Domain {
+			return errs.ErrInheritanceAcrossDomains
+		}
+		subs, err := implicitSubs(ptx, role2CasbinSub(child))
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if sub == role2CasbinSub(parent) {
+				return errs.ErrInheritanceCycle
+			}
+		}
+		before, err := ctl.Snapshot(tx, parent)
+		if err != nil {
+			return err
+		}
+		if ok, err := ptx.AddGroupingPolicy(role2CasbinSub(parent), role2CasbinSub(child)); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+		if err := ctl.CheckRolesSSD(tx, []perm.Role{parent}); err != nil {
+			return err
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionAddInheritance, Role: parent, Before: before, Detail: fmt.Sprintf("child=%d", child)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, parent)
+	})
 }
 
-func (ctl *Controller) DisableRoleTx(db *gorm.DB, role perm.Role) error {
-	return db.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
-		"enable": false,
-	}).Error
+func (ctl *Controller) DeleteInheritance(ctx context.Context, parent, child perm.Role) error {
+	return ctl.DeleteInheritanceTx(ctl.db.WithContext(ctx), parent, child)
+}
+
+func (ctl *Controller) DeleteInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	return ctl.transaction(db, func(tx *gorm.DB, ptx *casbinTx) error {
+		before, err := ctl.Snapshot(tx, parent)
+		if err != nil {
+			return err
+		}
+		if ok, err := ptx.RemoveGroupingPolicy(role2CasbinSub(parent), role2CasbinSub(child)); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+		if err := ctl.AuditRole(tx, &audit.Entry{Action: audit.ActionDeleteInheritance, Role: parent, Before: before, Detail: fmt.Sprintf("child=%d", child)}); err != nil {
+			return err
+		}
+		return ctl.Publish(tx, parent)
+	})
+}
+
+func (ctl *Controller) ListAncestors(ctx context.Context, role perm.Role) ([]perm.Role, error) {
+	return ctl.ListAncestorsTx(ctl.db.WithContext(ctx), role)
+}
+
+func (ctl *Controller) ListAncestorsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	p := ctl.policy(db)
+	var subs []string
+	visited := map[string]bool{role2CasbinSub(role): true}
+	queue := []string{role2CasbinSub(role)}
+	for len(queue) > 0 {
+		rules, err := p.GetFilteredGroupingPolicy(1, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		for _, rule := range rules {
+			if len(rule) == 2 && !visited[rule[0]] {
+				visited[rule[0]] = true
+				subs = append(subs, rule[0])
+				queue = append(queue, rule[0])
+			}
+		}
+	}
+	return casbinSubs2Roles(subs), nil
+}
+
+func (ctl *Controller) ListDescendants(ctx context.Context, role perm.Role) ([]perm.Role, error) {
+	return ctl.ListDescendantsTx(ctl.db.WithContext(ctx), role)
+}
+
+func (ctl *Controller) ListDescendantsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	subs, err := implicitSubs(ctl.policy(db), role2CasbinSub(role))
+	if err != nil {
+		return nil, err
+	}
+	return casbinSubs2Roles(subs), nil
+}
+
+func (ctl *Controller) FilterPermRoles(db *gorm.DB, q *perm.RoleQuery) (*gorm.DB, error) {
+	rules, err := ctl.policy(db).GetFilteredPolicy(2, string(q.Obj), string(q.Act))
+	if err != nil {
+		return nil, err
+	}
+	var roles []perm.Role
+	for _, rule := range rules {
+		if _, ok := ruleExt(rule); !ok || ruleEffect(rule) != perm.EffectAllow {
+			continue
+		}
+		if q.Domain != perm.GlobalDomain && !matchCasbinDomain(rule, q.Domain) {
+			continue
+		}
+		roles = append(roles, casbinSubs2Roles(rule[:1])...)
+	}
+	if len(roles) == 0 {
+		return db.Where("1 = 0"), nil
+	}
+	return db.Where("id IN ?", rbac0common.UniqueRoles(roles)), nil
 }
 
 // --- internal method ---
 
-func (ctl *Controller) toRolePerms(dbRole *model.Role) (*perm.RolePerms, error) {
-	rules, err := ctl.e.GetPermissionsForUser(roleID2CasbinSub(dbRole.ID))
+// checkPerm 检查role(含继承角色)在domain中对obj/act的权限，拒绝优先，内置admin不受拒绝权限约束
+// 带条件的权限按attrs求值；角色不存在时返回 errs.ErrRoleNotFound；t不为nil时记录检查过程
+func (ctl *Controller) checkPerm(tx *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}, t *perm.Trace) (*perm.Decision, *model.Role, error) {
+	dbRole := &model.Role{}
+	if err := tx.Where("id = ? AND domain IN ?", role, rbac0common.DomainScope(domain)).First(dbRole).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			t.AddStep(perm.TraceStepRole, role, "role not found in domain %q", domain)
+		}
+		return nil, nil, rbac0common.RoleErr(err)
+	}
+	t.AddStep(perm.TraceStepRole, role, "role found: domain=%q enable=%v admin=%v", dbRole.Domain, dbRole.Enable, dbRole.IsAdmin)
+	if !dbRole.Enable {
+		return &perm.Decision{Reason: perm.ReasonRoleDisabled, Role: role}, dbRole, nil
+	}
+	if dbRole.IsAdmin {
+		return &perm.Decision{Allowed: true, Reason: perm.ReasonAdminBypass, Role: role}, dbRole, nil
+	}
+	now := time.Now().UnixMilli()
+	if t != nil {
+		if err := ctl.traceGrants(tx, domain, role, now, attrs, t); err != nil {
+			return nil, nil, err
+		}
+	}
+	e, err := ctl.enforcer(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, explain, err := e.EnforceEx(role2CasbinSub(role), domain2CasbinDom(domain), string(obj), string(act), &casbinEnv{now: now, attrs: attrs})
+	if err != nil {
+		return nil, nil, err
+	}
+	// explain为决定结果的policy
+	var grant *perm.Perm
+	var grantRole perm.Role
+	if ps := casbinRules2Perms([][]string{explain}); len(ps) == 1 {
+		grant = &ps[0]
+		if grantRoles := casbinSubs2Roles([]string{explain[0]}); len(grantRoles) == 1 {
+			grantRole = grantRoles[0]
+		}
+	}
+	if ok {
+		return &perm.Decision{Allowed: true, Reason: perm.ReasonGranted, Role: role, Grant: grant, GrantRole: grantRole}, dbRole, nil
+	}
+	if grant != nil && grant.Effect == perm.EffectDeny {
+		return &perm.Decision{Reason: perm.ReasonDenied, Role: role, Grant: grant, GrantRole: grantRole}, dbRole, nil
+	}
+	return &perm.Decision{Reason: perm.ReasonNoGrant, Role: role}, dbRole, nil
+}
+
+// traceGrants 在t中记录role的继承角色与在domain中的候选权限，候选权限按内置的匹配规则(见 perm.Perm.Applies)展示
+func (ctl *Controller) traceGrants(tx *gorm.DB, domain perm.Domain, role perm.Role, now int64, attrs map[string]interface{}, t *perm.Trace) error {
+	p := ctl.policy(tx)
+	subs, err := implicitSubs(p, role2CasbinSub(role))
+	if err != nil {
+		return err
+	}
+	t.AddStep(perm.TraceStepInherit, role, "inherits roles %v", casbinSubs2Roles(subs))
+	for _, sub := range append([]string{role2CasbinSub(role)}, subs...) {
+		rules, err := p.GetFilteredPolicy(0, sub)
+		if err != nil {
+			return err
+		}
+		var grantRole perm.Role
+		if grantRoles := casbinSubs2Roles([]string{sub}); len(grantRoles) == 1 {
+			grantRole = grantRoles[0]
+		}
+		for _, rule := range rules {
+			if !matchCasbinDomain(rule, domain) {
+				continue
+			}
+			if ps := casbinRules2Perms([][]string{rule}); len(ps) == 1 {
+				t.AddGrant(role, grantRole, ps[0], now, attrs)
+			}
+		}
+	}
+	return nil
+}
+
+func (ctl *Controller) toRolePerms(p casbinPolicy, dbRole *model.Role) (*perm.RolePerms, error) {
+	rules, err := p.GetFilteredPolicy(0, roleID2CasbinSub(dbRole.ID))
 	if err != nil {
 		return nil, err
 	}
+	subs, err := implicitSubs(p, roleID2CasbinSub(dbRole.ID))
+	if err != nil {
+		return nil, err
+	}
+	var inheritedRules [][]string
+	for _, sub := range subs {
+		if subRules, err := p.GetFilteredPolicy(0, sub); err != nil {
+			return nil, err
+		} else {
+			inheritedRules = append(inheritedRules, subRules...)
+		}
+	}
+	perms := casbinRules2Perms(rules)
 	return &perm.RolePerms{
 		CreatedAt: dbRole.CreatedAt,
+		Domain:    dbRole.Domain,
 		Role:      perm.Role(dbRole.ID),
 		Enable:    dbRole.Enable,
 		IsAdmin:   dbRole.IsAdmin,
 		Creator:   dbRole.Creator,
 		Name:      dbRole.Name,
 		Desc:      dbRole.Desc,
-		Perms:     casbinRules2Perms(rules),
+		Perms:     perms,
+		// 过滤掉与直接授予的权限重复的继承权限
+		InheritedPerms: rbac0common.ToInheritedPerms(perms, casbinRules2Perms(inheritedRules)),
 	}, nil
 }
 
 // --- internal function ---
 
-func toRoleInfo(dbRole *model.Role) *perm.RoleInfo {
-	return &perm.RoleInfo{
-		CreatedAt: dbRole.CreatedAt,
-		Role:      perm.Role(dbRole.ID),
-		Enable:    dbRole.Enable,
-		IsAdmin:   dbRole.IsAdmin,
-		Creator:   dbRole.Creator,
-		Name:      dbRole.Name,
-		Desc:      dbRole.Desc,
+// implicitSubs 查询sub直接与间接继承的角色，与 casbin.Enforcer.GetImplicitRolesForUser 一致
+func implicitSubs(p casbinPolicy, sub string) ([]string, error) {
+	var subs []string
+	visited := map[string]bool{sub: true}
+	queue := []string{sub}
+	for len(queue) > 0 {
+		rules, err := p.GetFilteredGroupingPolicy(0, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		for _, rule := range rules {
+			if len(rule) == 2 && !visited[rule[1]] {
+				visited[rule[1]] = true
+				subs = append(subs, rule[1])
+				queue = append(queue, rule[1])
+			}
+		}
+	}
+	return subs, nil
+}
+
+// samePermRules 查询与rule为同一权限(sub, dom, obj, act, eft与条件均相同，不区分有效期)的policy
+func samePermRules(p casbinPolicy, rule []string) ([][]string, error) {
+	rules, err := p.GetFilteredPolicy(0, rule[:casbinExtIndex]...)
+	if err != nil {
+		return nil, err
+	}
+	ext, _ := ruleExt(rule)
+	var rets [][]string
+	for _, r := range rules {
+		if rExt, ok := ruleExt(r); ok && rExt.Cond == ext.Cond {
+			rets = append(rets, r)
+		}
 	}
+	return rets, nil
 }
 
 func roleID2CasbinSub(roleID int64) string {
@@ -392,23 +845,133 @@ func role2CasbinSub(role perm.Role) string {
 	return strconv.Itoa(int(role))
 }
 
-// []perm.Perm -> [][]string{{sub, obj, act}}
+func ruleSubs(rules [][]string) []string {
+	var subs []string
+	for _, rule := range rules {
+		subs = append(subs, rule[0])
+	}
+	return subs
+}
+
+func casbinSubs2Roles(subs []string) []perm.Role {
+	var roles []perm.Role
+	for _, sub := range subs {
+		if role, err := strconv.ParseUint(sub, 10, 32); err == nil {
+			roles = append(roles, perm.Role(role))
+		}
+	}
+	return roles
+}
+
+// perm.GlobalDomain -> "*"
+func domain2CasbinDom(domain perm.Domain) string {
+	if domain == perm.GlobalDomain {
+		// 避免policy中出现空字段
+		return casbinGlobalDom
+	}
+	return string(domain)
+}
+
+// "*" -> perm.GlobalDomain
+func casbinDom2Domain(dom string) perm.Domain {
+	if dom == casbinGlobalDom {
+		return perm.GlobalDomain
+	}
+	return perm.Domain(dom)
+}
+
+// perm.EffectAllow -> "allow"
+func effect2CasbinEft(effect perm.Effect) string {
+	if effect == perm.EffectDeny {
+		return casbinEftDeny
+	}
+	return casbinEftAllow
+}
+
+// {sub, dom, obj, act, eft, ext} -> perm.Effect，缺少eft时视为允许
+func ruleEffect(rule []string) perm.Effect {
+	if len(rule) > 4 && rule[4] == casbinEftDeny {
+		return perm.EffectDeny
+	}
+	return perm.EffectAllow
+}
+
+// validatePerms 校验权限的条件表达式，以及扩展字段不超过casbin_rule的列长度
+func validatePerms(perms []perm.Perm) error {
+	if err := rbac0common.ValidatePerms(perms); err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if ext := perm2CasbinExt(p); len(ext) > casbinExtSize {
+			return fmt.Errorf("perm cond %q too long: casbin policy ext is %d bytes, exceeds %d", p.Cond, len(ext), casbinExtSize)
+		}
+	}
+	return nil
+}
+
+// perm.Perm -> JSON编码的 casbinExt
+func perm2CasbinExt(p perm.Perm) string {
+	ext, _ := json.Marshal(&casbinExt{NotBefore: p.NotBefore, ExpiresAt: p.ExpiresAt, Cond: p.Cond})
+	return string(ext)
+}
+
+// {sub, dom, obj, act, eft, ext} -> casbinExt，缺少ext时为零值
+// ext无法解析(例如被截断)时返回false，此时policy不生效，避免失去有效期与条件后变为无条件的权限
+func ruleExt(rule []string) (casbinExt, bool) {
+	var ext casbinExt
+	if len(rule) > casbinExtIndex && rule[casbinExtIndex] != "" {
+		if err := json.Unmarshal([]byte(rule[casbinExtIndex]), &ext); err != nil {
+			return casbinExt{}, false
+		}
+	}
+	return ext, true
+}
+
+// ruleExpired 判断policy在now(毫秒时间戳)时是否已过期
+func ruleExpired(rule []string, now int64) bool {
+	ext, ok := ruleExt(rule)
+	return ok && perm.Perm{ExpiresAt: ext.ExpiresAt}.Expired(now)
+}
+
+// matchCasbinDomain 与model中的matcher一致：policy的域在domain中生效
+func matchCasbinDomain(rule []string, domain perm.Domain) bool {
+	if len(rule) < 4 {
+		return false
+	}
+	return rule[1] == casbinGlobalDom || rule[1] == domain2CasbinDom(domain)
+}
+
+// []perm.Perm -> [][]string{{sub, dom, obj, act, eft, ext}}
 func perms2CasbinRules(sub string, perms []perm.Perm) [][]string {
 	var ps [][]string
 	for _, p := range perms {
-		ps = append(ps, []string{sub, string(p.Obj), string(p.Act)})
+		ps = append(ps, perm2CasbinRule(sub, p))
 	}
 	return ps
 }
 
-// [][]string{{sub, obj, act}} -> []perm.Perm
+// perm.Perm -> []string{sub, dom, obj, act, eft, ext}
+func perm2CasbinRule(sub string, p perm.Perm) []string {
+	return []string{sub, domain2CasbinDom(p.Domain), string(p.Obj), string(p.Act), effect2CasbinEft(p.Effect), perm2CasbinExt(p)}
+}
+
+// [][]string{{sub, dom, obj, act, eft, ext}} -> []perm.Perm，忽略ext无法解析的policy
 func casbinRules2Perms(ps [][]string) []perm.Perm {
 	var perms []perm.Perm
 	for _, p := range ps {
-		if len(p) == 3 {
+		if len(p) >= 4 {
+			ext, ok := ruleExt(p)
+			if !ok {
+				continue
+			}
 			perms = append(perms, perm.Perm{
-				Obj: perm.Obj(p[1]),
-				Act: perm.Act(p[2]),
+				Domain:    casbinDom2Domain(p[1]),
+				Obj:       perm.Obj(p[2]),
+				Act:       perm.Act(p[3]),
+				Effect:    ruleEffect(p),
+				NotBefore: ext.NotBefore,
+				ExpiresAt: ext.ExpiresAt,
+				Cond:      ext.Cond,
 			})
 		}
 	}
@@ -0,0 +1,135 @@
+package rbac0
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/rbac"
+	defaultrolemanager "github.com/casbin/casbin/v2/rbac/default-role-manager"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+// casbinExtFunc matcher中判断policy扩展字段(有效期与条件)的函数，见 extMatch
+const casbinExtFunc = "extMatch"
+
+// casbinEnv 请求中的检查环境(r.env)，传给 extMatch
+type casbinEnv struct {
+	now   int64
+	attrs map[string]interface{}
+}
+
+// AddMatcherFunction 注册可在model的matcher中调用的函数，须在首次检查权限前注册，同名函数只能注册一次
+func (ctl *Controller) AddMatcherFunction(name string, fn func(args ...interface{}) (interface{}, error)) error {
+	if name == "" || fn == nil {
+		return errors.New("invalid matcher function")
+	}
+	ctl.fnsMu.Lock()
+	defer ctl.fnsMu.Unlock()
+	if _, ok := ctl.fns[name]; ok || name == casbinExtFunc {
+		return fmt.Errorf("matcher function %s already registered", name)
+	}
+	ctl.fns[name] = fn
+	ctl.e.AddFunction(name, fn)
+	return nil
+}
+
+// BuiltinMatcher model的matcher与policy effect与 DefaultModel 一致时返回true，此时权限判定与 perm.Perm.Applies 一致
+func (ctl *Controller) BuiltinMatcher() bool {
+	return ctl.builtin
+}
+
+// --- internal method ---
+
+// enforcer 用于检查权限的enforcer
+// db所在的 transaction 有未应用到内存的修改时，返回叠加了这些修改的临时enforcer
+// 临时enforcer在事务中只创建一次，之后的修改增量应用，不再复制全部policy
+func (ctl *Controller) enforcer(db *gorm.DB) (casbin.IEnforcer, error) {
+	ptx := ctl.policyTx(db)
+	if ptx == nil || len(ptx.ops) == 0 {
+		return ctl.e, nil
+	}
+	if ptx.oe != nil {
+		for _, op := range ptx.ops[ptx.applied:] {
+			if err := applyOp(ptx.oe, op); err != nil {
+				return nil, err
+			}
+		}
+		ptx.applied = len(ptx.ops)
+		return ptx.oe, nil
+	}
+	e, err := ctl.newOverlayEnforcer(ptx)
+	if err != nil {
+		return nil, err
+	}
+	ptx.oe, ptx.applied = e, len(ptx.ops)
+	return e, nil
+}
+
+// newOverlayEnforcer 创建包含enforcer内存中的policy与ptx中全部修改的临时enforcer
+func (ctl *Controller) newOverlayEnforcer(ptx *casbinTx) (casbin.IEnforcer, error) {
+	e, err := casbin.NewEnforcer(ctl.m.Copy())
+	if err != nil {
+		return nil, err
+	}
+	e.SetRoleManager(newRoleManager())
+	ctl.addFunctions(e)
+	rules, err := ptx.GetFilteredPolicy(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		if _, err := e.AddPolicies(rules); err != nil {
+			return nil, err
+		}
+	}
+	groupingRules, err := ptx.GetFilteredGroupingPolicy(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(groupingRules) > 0 {
+		if _, err := e.AddGroupingPolicies(groupingRules); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// addFunctions 为e注册 extMatch 与已注册的matcher函数
+func (ctl *Controller) addFunctions(e casbin.IEnforcer) {
+	e.AddFunction(casbinExtFunc, extMatch)
+	ctl.fnsMu.RLock()
+	defer ctl.fnsMu.RUnlock()
+	for name, fn := range ctl.fns {
+		e.AddFunction(name, fn)
+	}
+}
+
+// --- internal function ---
+
+// newRoleManager 角色继承层数不超过 casbinMaxHierarchyLevel 的role manager
+func newRoleManager() rbac.RoleManager {
+	return defaultrolemanager.NewRoleManagerImpl(casbinMaxHierarchyLevel)
+}
+
+// extMatch extMatch(p.eft, p.ext, r.env)：policy在检查环境中是否生效，见 perm.Perm.Effective；p.ext无法解析时不生效
+func extMatch(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("%s: expected 3 arguments, got %d", casbinExtFunc, len(args))
+	}
+	eft, ok1 := args[0].(string)
+	ext, ok2 := args[1].(string)
+	env, ok3 := args[2].(*casbinEnv)
+	if !ok1 || !ok2 || !ok3 {
+		return false, fmt.Errorf("%s: expected (p.eft, p.ext, r.env)", casbinExtFunc)
+	}
+	rule := []string{"", "", "", "", eft, ext}
+	e, ok := ruleExt(rule)
+	if !ok {
+		// ext无法解析时policy不生效
+		return false, nil
+	}
+	p := perm.Perm{Effect: ruleEffect(rule), NotBefore: e.NotBefore, ExpiresAt: e.ExpiresAt, Cond: e.Cond}
+	return p.Effective(env.now, env.attrs), nil
+}
@@ -0,0 +1,88 @@
+package rbac0
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	casbinmodel "github.com/casbin/casbin/v2/model"
+)
+
+// DefaultModel 内置的RBAC0 model
+//
+//go:embed model.conf
+var DefaultModel string
+
+// NewModelFromFS 从fsys中的path加载model
+func NewModelFromFS(fsys fs.FS, path string) (casbinmodel.Model, error) {
+	text, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return casbinmodel.NewModelFromString(string(text))
+}
+
+// validateModel 校验model与policy的读写方式兼容：
+// 请求为 sub, dom, obj, act, env；policy为 sub, dom, obj, act, eft, ext；角色继承为 g = _, _；
+// matcher须调用 extMatch(p.eft, p.ext, r.env)，否则有效期与条件不生效
+func validateModel(m casbinmodel.Model) error {
+	if m == nil {
+		return errors.New("casbin model is nil")
+	}
+	r, err := m.GetAssertion("r", "r")
+	if err != nil {
+		return fmt.Errorf("casbin model: %w", err)
+	}
+	if len(r.Tokens) != 5 {
+		return fmt.Errorf("casbin model: request definition should be sub, dom, obj, act, env, got %q", r.Value)
+	}
+	p, err := m.GetAssertion("p", "p")
+	if err != nil {
+		return fmt.Errorf("casbin model: %w", err)
+	}
+	if len(p.Tokens) != casbinExtIndex+1 || p.Tokens[4] != "p_eft" {
+		return fmt.Errorf("casbin model: policy definition should be sub, dom, obj, act, eft, ext, got %q", p.Value)
+	}
+	g, err := m.GetAssertion("g", "g")
+	if err != nil {
+		return fmt.Errorf("casbin model: %w", err)
+	}
+	if strings.Count(g.Value, "_") != 2 {
+		return fmt.Errorf("casbin model: role definition should be _, _, got %q", g.Value)
+	}
+	if _, err := m.GetAssertion("e", "e"); err != nil {
+		return fmt.Errorf("casbin model: %w", err)
+	}
+	matcher, err := m.GetAssertion("m", "m")
+	if err != nil {
+		return fmt.Errorf("casbin model: %w", err)
+	}
+	if !strings.Contains(matcher.Value, casbinExtFunc+"(") {
+		return fmt.Errorf("casbin model: matcher should call %s(p.eft, p.ext, r.env), got %q", casbinExtFunc, matcher.Value)
+	}
+	return nil
+}
+
+// builtinModel m的matcher与policy effect是否与 DefaultModel 一致
+func builtinModel(m casbinmodel.Model) bool {
+	d, err := casbinmodel.NewModelFromString(DefaultModel)
+	if err != nil {
+		return false
+	}
+	for _, sec := range []string{"e", "m"} {
+		a, err := m.GetAssertion(sec, sec)
+		if err != nil {
+			return false
+		}
+		b, err := d.GetAssertion(sec, sec)
+		if err != nil {
+			return false
+		}
+		if a.Value != b.Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,350 @@
+package rbac0
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+const (
+	// casbin policy表名，与 gormadapter.NewAdapterByDB 一致
+	casbinRuleTable = "casbin_rule"
+	casbinSecP      = "p"
+	casbinSecG      = "g"
+)
+
+// casbinPolicy casbin policy查询，由enforcer内存或事务中的 casbinTx 提供
+type casbinPolicy interface {
+	GetFilteredPolicy(fieldIndex int, fieldValues ...string) ([][]string, error)
+	GetFilteredGroupingPolicy(fieldIndex int, fieldValues ...string) ([][]string, error)
+}
+
+// casbinTx 事务中的casbin policy修改
+// 修改通过绑定事务的adapter写入casbin_rule表，并记录在ops中，事务提交后再应用到enforcer内存
+// 事务中的查询在enforcer内存的基础上叠加ops，可以看到本事务的修改
+type casbinTx struct {
+	e   casbin.IDistributedEnforcer
+	a   *gormadapter.Adapter
+	ops []casbinOp
+
+	// 叠加了ops的临时enforcer，事务中首次检查权限时创建，之后增量应用新的ops，见 Controller.enforcer
+	oe casbin.IEnforcer
+	// 已应用到oe的ops数
+	applied int
+}
+
+type casbinOp struct {
+	add   bool
+	sec   string
+	rules [][]string
+}
+
+type casbinTxKey struct{}
+
+// policy db中的casbin policy查询，db处于 transaction 中时可以看到事务中的修改
+func (ctl *Controller) policy(db *gorm.DB) casbinPolicy {
+	if ptx := ctl.policyTx(db); ptx != nil {
+		return ptx
+	}
+	return ctl.e
+}
+
+// transaction 在事务中执行fn，fn通过ptx修改casbin policy，事务提交后应用到enforcer内存
+// db已处于 transaction 中时复用外层的ptx，由外层在提交后应用
+// 注意：调用方传入的db已是调用方的事务时，修改在本方法返回时应用到内存，调用方回滚后内存中的policy在下次加载时恢复
+func (ctl *Controller) transaction(db *gorm.DB, fn func(tx *gorm.DB, ptx *casbinTx) error) error {
+	if ptx := ctl.policyTx(db); ptx != nil {
+		return db.Transaction(func(tx *gorm.DB) error {
+			// 内层事务回滚时丢弃其修改
+			n := len(ptx.ops)
+			if err := fn(tx, ptx); err != nil {
+				ptx.rollback(n)
+				return err
+			}
+			return nil
+		})
+	}
+	ptx := &casbinTx{e: ctl.e}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		tx = tx.WithContext(context.WithValue(ctx, casbinTxKey{}, ptx))
+		a, err := gormadapter.NewFilteredAdapterByDB(tx, "", casbinRuleTable)
+		if err != nil {
+			return err
+		}
+		ptx.a = a
+		return fn(tx, ptx)
+	}); err != nil {
+		return err
+	}
+	return ptx.apply()
+}
+
+// policyTx db所在的 transaction 的casbin policy修改，不在 transaction 中时为nil
+func (ctl *Controller) policyTx(db *gorm.DB) *casbinTx {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	if ptx, ok := db.Statement.Context.Value(casbinTxKey{}).(*casbinTx); ok && ptx.e == ctl.e {
+		return ptx
+	}
+	return nil
+}
+
+func (ptx *casbinTx) GetFilteredPolicy(fieldIndex int, fieldValues ...string) ([][]string, error) {
+	rules, err := ptx.e.GetFilteredPolicy(fieldIndex, fieldValues...)
+	if err != nil {
+		return nil, err
+	}
+	return ptx.overlay(casbinSecP, rules, fieldIndex, fieldValues), nil
+}
+
+func (ptx *casbinTx) GetFilteredGroupingPolicy(fieldIndex int, fieldValues ...string) ([][]string, error) {
+	rules, err := ptx.e.GetFilteredGroupingPolicy(fieldIndex, fieldValues...)
+	if err != nil {
+		return nil, err
+	}
+	return ptx.overlay(casbinSecG, rules, fieldIndex, fieldValues), nil
+}
+
+// AddPolicies 添加policy，忽略已存在的policy
+func (ptx *casbinTx) AddPolicies(rules [][]string) error {
+	return ptx.add(casbinSecP, rules)
+}
+
+// RemovePolicies 删除policy，忽略不存在的policy
+func (ptx *casbinTx) RemovePolicies(rules [][]string) error {
+	return ptx.remove(casbinSecP, rules)
+}
+
+// AddGroupingPolicy 添加角色继承关系，已存在时返回false
+func (ptx *casbinTx) AddGroupingPolicy(parent, child string) (bool, error) {
+	rules, err := ptx.GetFilteredGroupingPolicy(0, parent, child)
+	if err != nil {
+		return false, err
+	}
+	if len(rules) > 0 {
+		return false, nil
+	}
+	return true, ptx.add(casbinSecG, [][]string{{parent, child}})
+}
+
+// RemoveGroupingPolicy 删除角色继承关系，不存在时返回false
+func (ptx *casbinTx) RemoveGroupingPolicy(parent, child string) (bool, error) {
+	rules, err := ptx.GetFilteredGroupingPolicy(0, parent, child)
+	if err != nil {
+		return false, err
+	}
+	if len(rules) == 0 {
+		return false, nil
+	}
+	return true, ptx.remove(casbinSecG, rules)
+}
+
+// RemoveFilteredGroupingPolicy 删除匹配的角色继承关系
+func (ptx *casbinTx) RemoveFilteredGroupingPolicy(fieldIndex int, fieldValues ...string) error {
+	rules, err := ptx.GetFilteredGroupingPolicy(fieldIndex, fieldValues...)
+	if err != nil {
+		return err
+	}
+	return ptx.remove(casbinSecG, rules)
+}
+
+// --- internal method ---
+
+func (ptx *casbinTx) add(sec string, rules [][]string) error {
+	var newRules [][]string
+	for _, rule := range rules {
+		if exist, err := ptx.has(sec, rule); err != nil {
+			return err
+		} else if !exist && !containsRule(newRules, rule) {
+			newRules = append(newRules, rule)
+		}
+	}
+	if len(newRules) == 0 {
+		return nil
+	}
+	if err := ptx.a.AddPolicies(sec, sec, newRules); err != nil {
+		return err
+	}
+	ptx.ops = append(ptx.ops, casbinOp{add: true, sec: sec, rules: newRules})
+	return nil
+}
+
+func (ptx *casbinTx) remove(sec string, rules [][]string) error {
+	var oldRules [][]string
+	for _, rule := range rules {
+		if exist, err := ptx.has(sec, rule); err != nil {
+			return err
+		} else if exist && !containsRule(oldRules, rule) {
+			oldRules = append(oldRules, rule)
+		}
+	}
+	if len(oldRules) == 0 {
+		return nil
+	}
+	for _, rule := range oldRules {
+		if err := ptx.a.RemovePolicy(sec, sec, rule); err != nil {
+			return err
+		}
+	}
+	ptx.ops = append(ptx.ops, casbinOp{add: false, sec: sec, rules: oldRules})
+	return nil
+}
+
+func (ptx *casbinTx) has(sec string, rule []string) (bool, error) {
+	var rules [][]string
+	var err error
+	if sec == casbinSecG {
+		rules, err = ptx.GetFilteredGroupingPolicy(0, rule...)
+	} else {
+		rules, err = ptx.GetFilteredPolicy(0, rule...)
+	}
+	if err != nil {
+		return false, err
+	}
+	return containsRule(rules, rule), nil
+}
+
+// rollback 丢弃第n个之后的ops，临时enforcer已应用这些ops时重新创建
+func (ptx *casbinTx) rollback(n int) {
+	ptx.ops = ptx.ops[:n]
+	if ptx.applied > n {
+		ptx.oe = nil
+		ptx.applied = 0
+	}
+}
+
+// overlay 在enforcer内存中匹配的rules上按顺序叠加ops
+func (ptx *casbinTx) overlay(sec string, rules [][]string, fieldIndex int, fieldValues []string) [][]string {
+	for _, op := range ptx.ops {
+		if op.sec != sec {
+			continue
+		}
+		for _, rule := range op.rules {
+			if !matchFilter(rule, fieldIndex, fieldValues) {
+				continue
+			}
+			if op.add {
+				if !containsRule(rules, rule) {
+					rules = append(rules, rule)
+				}
+			} else {
+				rules = removeRule(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
+// apply 事务提交后将ops应用到enforcer内存，不再写入adapter
+func (ptx *casbinTx) apply() error {
+	shouldPersist := func() bool { return false }
+	for _, op := range ptx.ops {
+		var err error
+		if op.add {
+			_, err = ptx.e.AddPoliciesSelf(shouldPersist, op.sec, op.sec, op.rules)
+		} else {
+			_, err = ptx.e.RemovePoliciesSelf(shouldPersist, op.sec, op.sec, op.rules)
+		}
+		if err != nil {
+			// 数据库已提交，重新加载使内存与数据库一致
+			return ptx.e.LoadPolicy()
+		}
+	}
+	return nil
+}
+
+// --- internal function ---
+
+// migrateLegacyPolicy 将旧版本model(p = sub, obj, act)写入的policy改写为 {sub, "*", obj, act, allow, ext}
+// 旧policy的dom与act列为空，按当前model读取时各列错位，所有权限都会失效
+func migrateLegacyPolicy(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rules []*gormadapter.CasbinRule
+		if err := tx.Table(casbinRuleTable).Where("ptype = ? AND COALESCE(v3, '') = '' AND COALESCE(v4, '') = ''", casbinSecP).
+			Find(&rules).Error; err != nil {
+			return err
+		}
+		for _, r := range rules {
+			rule := perm2CasbinRule(r.V0, perm.Perm{Obj: perm.Obj(r.V1), Act: perm.Act(r.V2)})
+			var count int64
+			if err := tx.Table(casbinRuleTable).Where("ptype = ? AND v0 = ? AND v1 = ? AND v2 = ? AND v3 = ? AND v4 = ? AND v5 = ?",
+				casbinSecP, rule[0], rule[1], rule[2], rule[3], rule[4], rule[5]).Count(&count).Error; err != nil {
+				return err
+			}
+			// 已存在相同的policy时删除旧policy
+			if count > 0 {
+				if err := tx.Table(casbinRuleTable).Where("id = ?", r.ID).Delete(&gormadapter.CasbinRule{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Table(casbinRuleTable).Where("id = ?", r.ID).Updates(map[string]interface{}{
+				"v1": rule[1],
+				"v2": rule[2],
+				"v3": rule[3],
+				"v4": rule[4],
+				"v5": rule[5],
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyOp 将op应用到e，不写入adapter
+func applyOp(e casbin.IEnforcer, op casbinOp) error {
+	var err error
+	switch {
+	case op.sec == casbinSecG && op.add:
+		_, err = e.AddGroupingPolicies(op.rules)
+	case op.sec == casbinSecG:
+		_, err = e.RemoveGroupingPolicies(op.rules)
+	case op.add:
+		_, err = e.AddPolicies(op.rules)
+	default:
+		_, err = e.RemovePolicies(op.rules)
+	}
+	return err
+}
+
+// matchFilter 与casbin GetFilteredPolicy的过滤规则一致，空字符串匹配任意值
+func matchFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	for i, v := range fieldValues {
+		if v == "" {
+			continue
+		}
+		if fieldIndex+i >= len(rule) || rule[fieldIndex+i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRule(rules [][]string, rule []string) bool {
+	for _, r := range rules {
+		if util.ArrayEquals(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeRule(rules [][]string, rule []string) [][]string {
+	var rets [][]string
+	for _, r := range rules {
+		if !util.ArrayEquals(r, rule) {
+			rets = append(rets, r)
+		}
+	}
+	return rets
+}
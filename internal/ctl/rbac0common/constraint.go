@@ -0,0 +1,332 @@
+package rbac0common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+func (s *Store) CreateSSDSet(ctx context.Context, name string, roles []perm.Role, cardinality int) error {
+	return s.CreateSSDSetTx(s.db.WithContext(ctx), name, roles, cardinality)
+}
+
+func (s *Store) CreateSSDSetTx(db *gorm.DB, name string, roles []perm.Role, cardinality int) error {
+	roles = UniqueRoles(roles)
+	if cardinality < 2 || cardinality > len(roles) {
+		return fmt.Errorf("%w: ssd cardinality should be between 2 and %d", errs.ErrInvalidConstraint, len(roles))
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Role{}).Where("id IN ?", roles).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != int64(len(roles)) {
+			return RoleErr(gorm.ErrRecordNotFound)
+		}
+		dbSet := &model.SSDSet{
+			Name:        name,
+			Cardinality: cardinality,
+		}
+		if err := tx.Create(dbSet).Error; err != nil {
+			return err
+		}
+		var dbSetRoles []*model.SSDSetRole
+		for _, role := range roles {
+			dbSetRoles = append(dbSetRoles, &model.SSDSetRole{
+				SetID: dbSet.ID,
+				Role:  role,
+			})
+		}
+		if err := tx.Create(dbSetRoles).Error; err != nil {
+			return err
+		}
+		if err := audit.Record(tx, &audit.Entry{Action: audit.ActionCreateSSDSet, Detail: fmt.Sprintf("name=%s roles=%v cardinality=%d", name, roles, cardinality)}); err != nil {
+			return err
+		}
+		return s.CheckRolesSSD(tx, roles)
+	})
+}
+
+func (s *Store) DeleteSSDSet(ctx context.Context, name string) error {
+	return s.DeleteSSDSetTx(s.db.WithContext(ctx), name)
+}
+
+func (s *Store) DeleteSSDSetTx(db *gorm.DB, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		dbSet := &model.SSDSet{}
+		if err := tx.Where("name = ?", name).First(dbSet).Error; err != nil {
+			return ConstraintErr(err)
+		}
+		if err := tx.Unscoped().Where("set_id = ?", dbSet.ID).Delete(&model.SSDSetRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id = ?", dbSet.ID).Delete(&model.SSDSet{}).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, &audit.Entry{Action: audit.ActionDeleteSSDSet, Detail: fmt.Sprintf("name=%s", name)})
+	})
+}
+
+func (s *Store) ListSSDSets(ctx context.Context) ([]*perm.SSDSet, error) {
+	return s.ListSSDSetsTx(s.db.WithContext(ctx))
+}
+
+func (s *Store) ListSSDSetsTx(db *gorm.DB) ([]*perm.SSDSet, error) {
+	var rets []*perm.SSDSet
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var dbSets []*model.SSDSet
+		if err := tx.Order("id").Find(&dbSets).Error; err != nil {
+			return err
+		}
+		var dbSetRoles []*model.SSDSetRole
+		if err := tx.Order("role").Find(&dbSetRoles).Error; err != nil {
+			return err
+		}
+		for _, dbSet := range dbSets {
+			ret := &perm.SSDSet{
+				CreatedAt:   dbSet.CreatedAt,
+				Name:        dbSet.Name,
+				Cardinality: dbSet.Cardinality,
+			}
+			for _, dbSetRole := range dbSetRoles {
+				if dbSetRole.SetID == dbSet.ID {
+					ret.Roles = append(ret.Roles, dbSetRole.Role)
+				}
+			}
+			rets = append(rets, ret)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rets, nil
+}
+
+func (s *Store) CreateDSDSet(ctx context.Context, name string, roles []perm.Role, cardinality int) error {
+	return s.CreateDSDSetTx(s.db.WithContext(ctx), name, roles, cardinality)
+}
+
+func (s *Store) CreateDSDSetTx(db *gorm.DB, name string, roles []perm.Role, cardinality int) error {
+	roles = UniqueRoles(roles)
+	if cardinality < 2 || cardinality > len(roles) {
+		return fmt.Errorf("%w: dsd cardinality should be between 2 and %d", errs.ErrInvalidConstraint, len(roles))
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Role{}).Where("id IN ?", roles).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != int64(len(roles)) {
+			return RoleErr(gorm.ErrRecordNotFound)
+		}
+		dbSet := &model.DSDSet{
+			Name:        name,
+			Cardinality: cardinality,
+		}
+		if err := tx.Create(dbSet).Error; err != nil {
+			return err
+		}
+		var dbSetRoles []*model.DSDSetRole
+		for _, role := range roles {
+			dbSetRoles = append(dbSetRoles, &model.DSDSetRole{
+				SetID: dbSet.ID,
+				Role:  role,
+			})
+		}
+		if err := tx.Create(dbSetRoles).Error; err != nil {
+			return err
+		}
+		if err := audit.Record(tx, &audit.Entry{Action: audit.ActionCreateDSDSet, Detail: fmt.Sprintf("name=%s roles=%v cardinality=%d", name, roles, cardinality)}); err != nil {
+			return err
+		}
+		return s.Publish(tx)
+	})
+}
+
+func (s *Store) DeleteDSDSet(ctx context.Context, name string) error {
+	return s.DeleteDSDSetTx(s.db.WithContext(ctx), name)
+}
+
+func (s *Store) DeleteDSDSetTx(db *gorm.DB, name string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		dbSet := &model.DSDSet{}
+		if err := tx.Where("name = ?", name).First(dbSet).Error; err != nil {
+			return ConstraintErr(err)
+		}
+		if err := tx.Unscoped().Where("set_id = ?", dbSet.ID).Delete(&model.DSDSetRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id = ?", dbSet.ID).Delete(&model.DSDSet{}).Error; err != nil {
+			return err
+		}
+		if err := audit.Record(tx, &audit.Entry{Action: audit.ActionDeleteDSDSet, Detail: fmt.Sprintf("name=%s", name)}); err != nil {
+			return err
+		}
+		return s.Publish(tx)
+	})
+}
+
+func (s *Store) ListDSDSets(ctx context.Context) ([]*perm.DSDSet, error) {
+	return s.ListDSDSetsTx(s.db.WithContext(ctx))
+}
+
+func (s *Store) ListDSDSetsTx(db *gorm.DB) ([]*perm.DSDSet, error) {
+	var rets []*perm.DSDSet
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		var dbSets []*model.DSDSet
+		if err := tx.Order("id").Find(&dbSets).Error; err != nil {
+			return err
+		}
+		var dbSetRoles []*model.DSDSetRole
+		if err := tx.Order("role").Find(&dbSetRoles).Error; err != nil {
+			return err
+		}
+		for _, dbSet := range dbSets {
+			ret := &perm.DSDSet{
+				CreatedAt:   dbSet.CreatedAt,
+				Name:        dbSet.Name,
+				Cardinality: dbSet.Cardinality,
+			}
+			for _, dbSetRole := range dbSetRoles {
+				if dbSetRole.SetID == dbSet.ID {
+					ret.Roles = append(ret.Roles, dbSetRole.Role)
+				}
+			}
+			rets = append(rets, ret)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rets, nil
+}
+
+// CheckDSD 检查同时激活的roles(含继承角色)是否违反动态职责分离约束
+func (s *Store) CheckDSD(tx *gorm.DB, roles []perm.Role) error {
+	var dbSets []*model.DSDSet
+	if err := tx.Order("id").Find(&dbSets).Error; err != nil {
+		return err
+	}
+	if len(dbSets) == 0 {
+		return nil
+	}
+	active, err := s.withDescendants(tx, roles)
+	if err != nil {
+		return err
+	}
+	var dbSetRoles []*model.DSDSetRole
+	if err := tx.Order("role").Find(&dbSetRoles).Error; err != nil {
+		return err
+	}
+	for _, dbSet := range dbSets {
+		var conflicts []perm.Role
+		for _, dbSetRole := range dbSetRoles {
+			if dbSetRole.SetID == dbSet.ID && active[dbSetRole.Role] {
+				conflicts = append(conflicts, dbSetRole.Role)
+			}
+		}
+		if len(conflicts) >= dbSet.Cardinality {
+			return &perm.DSDViolationError{
+				Set:         dbSet.Name,
+				Cardinality: dbSet.Cardinality,
+				Roles:       conflicts,
+			}
+		}
+	}
+	return nil
+}
+
+// CheckRolesSSD 检查roles及继承roles的角色，以及被分配了这些角色的用户，是否违反静态职责分离约束
+func (s *Store) CheckRolesSSD(tx *gorm.DB, roles []perm.Role) error {
+	seniors := append([]perm.Role{}, roles...)
+	for _, role := range roles {
+		ancestors, err := s.b.ListAncestorsTx(tx, role)
+		if err != nil {
+			return err
+		}
+		seniors = append(seniors, ancestors...)
+	}
+	seniors = UniqueRoles(seniors)
+	for _, role := range seniors {
+		if err := s.checkSSD(tx, []perm.Role{role}); err != nil {
+			return err
+		}
+	}
+	var users []int64
+	if err := tx.Model(&model.UserRole{}).Where("role IN ?", seniors).Distinct().Pluck("user_id", &users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := s.CheckUserSSD(tx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckUserSSD 检查用户被授权的角色是否违反静态职责分离约束
+func (s *Store) CheckUserSSD(tx *gorm.DB, user int64) error {
+	roles, err := s.ListUserRolesTx(tx, user)
+	if err != nil {
+		return err
+	}
+	return s.checkSSD(tx, roles)
+}
+
+// --- internal method ---
+
+// checkSSD 检查roles(含继承角色)是否违反静态职责分离约束
+func (s *Store) checkSSD(tx *gorm.DB, roles []perm.Role) error {
+	var dbSets []*model.SSDSet
+	if err := tx.Order("id").Find(&dbSets).Error; err != nil {
+		return err
+	}
+	if len(dbSets) == 0 {
+		return nil
+	}
+	authorized, err := s.withDescendants(tx, roles)
+	if err != nil {
+		return err
+	}
+	var dbSetRoles []*model.SSDSetRole
+	if err := tx.Order("role").Find(&dbSetRoles).Error; err != nil {
+		return err
+	}
+	for _, dbSet := range dbSets {
+		var conflicts []perm.Role
+		for _, dbSetRole := range dbSetRoles {
+			if dbSetRole.SetID == dbSet.ID && authorized[dbSetRole.Role] {
+				conflicts = append(conflicts, dbSetRole.Role)
+			}
+		}
+		if len(conflicts) >= dbSet.Cardinality {
+			return &perm.SSDViolationError{
+				Set:         dbSet.Name,
+				Cardinality: dbSet.Cardinality,
+				Roles:       conflicts,
+			}
+		}
+	}
+	return nil
+}
+
+// withDescendants roles及其直接或间接继承的所有角色
+func (s *Store) withDescendants(tx *gorm.DB, roles []perm.Role) (map[perm.Role]bool, error) {
+	rets := make(map[perm.Role]bool)
+	for _, role := range roles {
+		rets[role] = true
+		descendants, err := s.b.ListDescendantsTx(tx, role)
+		if err != nil {
+			return nil, err
+		}
+		for _, descendant := range descendants {
+			rets[descendant] = true
+		}
+	}
+	return rets, nil
+}
@@ -0,0 +1,414 @@
+package rbac0common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gromitlee/access/internal/db/cursor"
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *Store) UpdateRole(ctx context.Context, role perm.Role, name, desc string) error {
+	return s.UpdateRoleTx(s.db.WithContext(ctx), role, name, desc)
+}
+
+func (s *Store) UpdateRoleTx(db *gorm.DB, role perm.Role, name, desc string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		before, err := s.Snapshot(tx, role)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return RoleErr(gorm.ErrRecordNotFound)
+		}
+		if err := tx.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
+			"name": name,
+			"desc": desc,
+		}).Error; err != nil {
+			return err
+		}
+		if err := s.AuditRole(tx, &audit.Entry{Action: audit.ActionUpdateRole, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return s.Publish(tx, role)
+	})
+}
+
+func (s *Store) EnableRole(ctx context.Context, role perm.Role) error {
+	return s.EnableRoleTx(s.db.WithContext(ctx), role)
+}
+
+func (s *Store) EnableRoleTx(db *gorm.DB, role perm.Role) error {
+	return s.setRoleEnable(db, role, true, audit.ActionEnableRole)
+}
+
+func (s *Store) DisableRole(ctx context.Context, role perm.Role) error {
+	return s.DisableRoleTx(s.db.WithContext(ctx), role)
+}
+
+func (s *Store) DisableRoleTx(db *gorm.DB, role perm.Role) error {
+	return s.setRoleEnable(db, role, false, audit.ActionDisableRole)
+}
+
+func (s *Store) ListRoleInfo(ctx context.Context, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
+	return s.ListRoleInfoTx(s.db.WithContext(ctx), domain, name, enable, offset, limit, order)
+}
+
+func (s *Store) ListRoleInfoTx(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
+	if offset < 0 || (limit <= 0 && limit != -1) {
+		return nil, 0, errs.ErrInvalidPagination
+	}
+	return s.QueryRoleInfoTx(db, legacyRoleQuery(domain, name, enable, offset, limit, order))
+}
+
+func (s *Store) GetRoleInfo(ctx context.Context, role perm.Role) (*perm.RoleInfo, error) {
+	return s.GetRoleInfoTx(s.db.WithContext(ctx), role)
+}
+
+func (s *Store) GetRoleInfoTx(db *gorm.DB, role perm.Role) (*perm.RoleInfo, error) {
+	dbRole := &model.Role{}
+	if err := db.Where("id = ?", role).First(dbRole).Error; err != nil {
+		return nil, RoleErr(err)
+	}
+	return ToRoleInfo(dbRole), nil
+}
+
+func (s *Store) GetRoleInfos(ctx context.Context, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
+	return s.GetRoleInfosTx(s.db.WithContext(ctx), roles, order)
+}
+
+func (s *Store) GetRoleInfosTx(db *gorm.DB, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
+	var dbRoles []*model.Role
+	if len(roles) > 0 {
+		db = db.Where("id IN ?", roles)
+	}
+	if order < 0 {
+		db = db.Order("id desc")
+	}
+	if err := db.Model(&model.Role{}).Find(&dbRoles).Error; err != nil {
+		return nil, err
+	}
+	var rets []*perm.RoleInfo
+	for _, dbRole := range dbRoles {
+		rets = append(rets, ToRoleInfo(dbRole))
+	}
+	return rets, nil
+}
+
+func (s *Store) ListRolePerms(ctx context.Context, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
+	return s.ListRolePermsTx(s.db.WithContext(ctx), domain, name, enable, offset, limit, order)
+}
+
+func (s *Store) ListRolePermsTx(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
+	if offset < 0 || (limit <= 0 && limit != -1) {
+		return nil, 0, errs.ErrInvalidPagination
+	}
+	return s.QueryRolePermsTx(db, legacyRoleQuery(domain, name, enable, offset, limit, order))
+}
+
+func (s *Store) QueryRoleInfo(ctx context.Context, q perm.RoleQuery) ([]*perm.RoleInfo, int64, error) {
+	return s.QueryRoleInfoTx(s.db.WithContext(ctx), q)
+}
+
+func (s *Store) QueryRoleInfoTx(db *gorm.DB, q perm.RoleQuery) ([]*perm.RoleInfo, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	if q.Cursor != "" {
+		return nil, 0, fmt.Errorf("%w: cursor requires PageRoleInfo", errs.ErrInvalidQuery)
+	}
+	var rets []*perm.RoleInfo
+	var count int64
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_tx, err := s.queryRoles(tx, &q)
+		if err != nil {
+			return err
+		}
+		var dbRoles []*model.Role
+		if err := _tx.Find(&dbRoles).
+			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+			return err
+		}
+		for _, dbRole := range dbRoles {
+			rets = append(rets, ToRoleInfo(dbRole))
+		}
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+	return rets, count, nil
+}
+
+func (s *Store) QueryRolePerms(ctx context.Context, q perm.RoleQuery) ([]*perm.RolePerms, int64, error) {
+	return s.QueryRolePermsTx(s.db.WithContext(ctx), q)
+}
+
+func (s *Store) QueryRolePermsTx(db *gorm.DB, q perm.RoleQuery) ([]*perm.RolePerms, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+	if q.Cursor != "" {
+		return nil, 0, fmt.Errorf("%w: cursor requires PageRolePerms", errs.ErrInvalidQuery)
+	}
+	var rets []*perm.RolePerms
+	var count int64
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		_tx, err := s.queryRoles(tx, &q)
+		if err != nil {
+			return err
+		}
+		var roles []perm.Role
+		if err := _tx.Pluck("id", &roles).
+			Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			ret, err := s.domainRolePerms(tx, role, q.Domain)
+			if err != nil {
+				return err
+			}
+			rets = append(rets, ret)
+		}
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+	return rets, count, nil
+}
+
+func (s *Store) PageRoleInfo(ctx context.Context, q perm.RoleQuery) (*perm.Page[*perm.RoleInfo], error) {
+	return s.PageRoleInfoTx(s.db.WithContext(ctx), q)
+}
+
+func (s *Store) PageRoleInfoTx(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RoleInfo], error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	ret := &perm.Page[*perm.RoleInfo]{}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		dbRoles, next, count, err := s.pageRoles(tx, &q)
+		if err != nil {
+			return err
+		}
+		for _, dbRole := range dbRoles {
+			ret.Items = append(ret.Items, ToRoleInfo(dbRole))
+		}
+		ret.Next, ret.Count = next, count
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Store) PageRolePerms(ctx context.Context, q perm.RoleQuery) (*perm.Page[*perm.RolePerms], error) {
+	return s.PageRolePermsTx(s.db.WithContext(ctx), q)
+}
+
+func (s *Store) PageRolePermsTx(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RolePerms], error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	ret := &perm.Page[*perm.RolePerms]{}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		dbRoles, next, count, err := s.pageRoles(tx, &q)
+		if err != nil {
+			return err
+		}
+		for _, dbRole := range dbRoles {
+			rolePerms, err := s.domainRolePerms(tx, perm.Role(dbRole.ID), q.Domain)
+			if err != nil {
+				return err
+			}
+			ret.Items = append(ret.Items, rolePerms)
+		}
+		ret.Next, ret.Count = next, count
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// CreateRoleRow 在tx中创建角色，指定的角色id已存在时返回 errs.ErrRoleExists，域不合法时返回 errs.ErrInvalidDomain
+func (s *Store) CreateRoleRow(tx *gorm.DB, dbRole *model.Role) error {
+	if err := dbRole.Domain.Validate(); err != nil {
+		return err
+	}
+	if dbRole.ID != 0 {
+		var count int64
+		if err := tx.Model(&model.Role{}).Where("id = ?", dbRole.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errs.ErrRoleExists
+		}
+	}
+	return tx.Create(dbRole).Error
+}
+
+// DeleteRoleRows 在tx中删除角色及其用户分配、会话激活与职责分离约束中的角色，角色权限与继承关系由实现删除
+func (s *Store) DeleteRoleRows(tx *gorm.DB, role perm.Role) error {
+	if err := tx.Unscoped().Where("role = ?", role).Delete(&model.UserRole{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("role = ?", role).Delete(&model.SessionRole{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("role = ?", role).Delete(&model.SSDSetRole{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("role = ?", role).Delete(&model.DSDSetRole{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id = ?", role).Delete(&model.Role{}).Error
+}
+
+// --- internal method ---
+
+func (s *Store) setRoleEnable(db *gorm.DB, role perm.Role, enable bool, action audit.Action) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		before, err := s.Snapshot(tx, role)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return RoleErr(gorm.ErrRecordNotFound)
+		}
+		if err := tx.Model(&model.Role{}).Where("id = ?", role).Updates(map[string]interface{}{
+			"enable": enable,
+		}).Error; err != nil {
+			return err
+		}
+		if err := s.AuditRole(tx, &audit.Entry{Action: action, Role: role, Before: before}); err != nil {
+			return err
+		}
+		return s.Publish(tx, role)
+	})
+}
+
+// domainRolePerms 查询角色权限，domain非空时仅保留在domain中生效的权限
+func (s *Store) domainRolePerms(tx *gorm.DB, role perm.Role, domain perm.Domain) (*perm.RolePerms, error) {
+	ret, err := s.b.GetRolePermsTx(tx, role)
+	if err != nil {
+		return nil, err
+	}
+	if domain != perm.GlobalDomain {
+		ret.Perms = FilterDomainPerms(ret.Perms, domain)
+		ret.InheritedPerms = FilterDomainPerms(ret.InheritedPerms, domain)
+	}
+	return ret, nil
+}
+
+// queryRoles 按q构造角色表的查询，包括排序与分页
+func (s *Store) queryRoles(tx *gorm.DB, q *perm.RoleQuery) (*gorm.DB, error) {
+	_tx := tx.Model(&model.Role{})
+	if q.Domain != perm.GlobalDomain {
+		_tx = _tx.Where("domain IN ?", DomainScope(q.Domain))
+	}
+	if len(q.Roles) > 0 {
+		_tx = _tx.Where("id IN ?", q.Roles)
+	}
+	if q.Name != "" {
+		_tx = _tx.Where("name = ?", q.Name)
+	}
+	if q.NameLike != "" {
+		_tx = _tx.Where("name LIKE ?", "%"+q.NameLike+"%")
+	}
+	if q.Enable != nil {
+		_tx = _tx.Where("enable = ?", *q.Enable)
+	}
+	if q.IsAdmin != nil {
+		_tx = _tx.Where("is_admin = ?", *q.IsAdmin)
+	}
+	if q.Creator != 0 {
+		_tx = _tx.Where("creator = ?", q.Creator)
+	}
+	if q.CreatedSince != 0 {
+		_tx = _tx.Where("created_at >= ?", q.CreatedSince)
+	}
+	if q.CreatedUntil != 0 {
+		_tx = _tx.Where("created_at < ?", q.CreatedUntil)
+	}
+	if q.Obj != "" {
+		var err error
+		if _tx, err = s.b.FilterPermRoles(_tx, q); err != nil {
+			return nil, err
+		}
+	}
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = perm.RoleSortID
+	}
+	_tx = _tx.Order(clause.OrderByColumn{Column: clause.Column{Name: string(sortBy)}, Desc: q.Desc})
+	if sortBy != perm.RoleSortID {
+		_tx = _tx.Order(clause.OrderByColumn{Column: clause.Column{Name: string(perm.RoleSortID)}, Desc: q.Desc})
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = -1
+	}
+	return _tx.Offset(int(q.Offset)).Limit(int(limit)), nil
+}
+
+// pageRoles 按q游标分页查询角色，返回本页角色、下一页游标与总数(未要求查询总数时为-1)
+func (s *Store) pageRoles(tx *gorm.DB, q *perm.RoleQuery) ([]*model.Role, string, int64, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = perm.RoleSortID
+	}
+	_tx, err := s.queryRoles(tx, q)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	// 计数与分页查询分别基于_tx
+	_tx = _tx.Session(&gorm.Session{})
+	count := int64(-1)
+	if q.WithCount {
+		if err := _tx.Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+			return nil, "", 0, err
+		}
+	}
+	if q.Cursor != "" {
+		c, err := cursor.Decode(q.Cursor, string(sortBy), q.Desc)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		_tx = c.After(_tx)
+	}
+	if q.Limit > 0 {
+		// 多查询一条判断是否有下一页
+		_tx = _tx.Limit(int(q.Limit + 1))
+	}
+	var dbRoles []*model.Role
+	if err := _tx.Find(&dbRoles).Error; err != nil {
+		return nil, "", 0, err
+	}
+	var next string
+	if q.Limit > 0 && int64(len(dbRoles)) > q.Limit {
+		dbRoles = dbRoles[:q.Limit]
+		next = cursor.Role(dbRoles[len(dbRoles)-1], sortBy, q.Desc).Encode()
+	}
+	return dbRoles, next, count, nil
+}
+
+// --- internal function ---
+
+// legacyRoleQuery ListRoleInfo / ListRolePerms 的参数转换为 perm.RoleQuery
+// enable大于0、小于0分别为启用、未启用，limit为-1表示不分页，order小于0时按id倒序
+func legacyRoleQuery(domain perm.Domain, name string, enable int32, offset, limit, order int64) perm.RoleQuery {
+	q := perm.RoleQuery{Domain: domain, NameLike: name, Desc: order < 0, Offset: offset}
+	if enable != 0 {
+		e := enable > 0
+		q.Enable = &e
+	}
+	if limit > 0 {
+		q.Limit = limit
+	}
+	return q
+}
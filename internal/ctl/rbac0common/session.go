@@ -0,0 +1,159 @@
+package rbac0common
+
+import (
+	"context"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+func (s *Store) CreateSession(ctx context.Context, domain perm.Domain, user int64, roles ...perm.Role) (int64, error) {
+	return s.CreateSessionTx(s.db.WithContext(ctx), domain, user, roles...)
+}
+
+func (s *Store) CreateSessionTx(db *gorm.DB, domain perm.Domain, user int64, roles ...perm.Role) (int64, error) {
+	if err := domain.Validate(); err != nil {
+		return 0, err
+	}
+	dbSession := &model.Session{
+		UserID: user,
+		Domain: domain,
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dbSession).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := s.AddActiveRoleTx(tx, dbSession.ID, role); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return dbSession.ID, nil
+}
+
+func (s *Store) AddActiveRole(ctx context.Context, session int64, role perm.Role) error {
+	return s.AddActiveRoleTx(s.db.WithContext(ctx), session, role)
+}
+
+func (s *Store) AddActiveRoleTx(db *gorm.DB, session int64, role perm.Role) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		dbSession := &model.Session{}
+		if err := tx.Where("id = ?", session).First(dbSession).Error; err != nil {
+			return SessionErr(err)
+		}
+		var count int64
+		if err := tx.Model(&model.UserRole{}).Where("user_id = ? AND role = ?", dbSession.UserID, role).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errs.ErrRoleNotAssigned
+		}
+		if err := tx.Model(&model.Role{}).Where("id = ? AND domain IN ?", role, DomainScope(dbSession.Domain)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errs.ErrRoleNotInDomain
+		}
+		if err := tx.Model(&model.SessionRole{}).Where("session = ? AND role = ?", session, role).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		if err := tx.Create(&model.SessionRole{
+			Session: session,
+			Role:    role,
+		}).Error; err != nil {
+			return err
+		}
+		var roles []perm.Role
+		if err := tx.Model(&model.SessionRole{}).Where("session = ?", session).Pluck("role", &roles).Error; err != nil {
+			return err
+		}
+		return s.CheckDSD(tx, roles)
+	})
+}
+
+func (s *Store) DropActiveRole(ctx context.Context, session int64, role perm.Role) error {
+	return s.DropActiveRoleTx(s.db.WithContext(ctx), session, role)
+}
+
+func (s *Store) DropActiveRoleTx(db *gorm.DB, session int64, role perm.Role) error {
+	return db.Where("session = ? AND role = ?", session, role).Delete(&model.SessionRole{}).Error
+}
+
+func (s *Store) GetSession(ctx context.Context, session int64) (*perm.SessionInfo, error) {
+	return s.GetSessionTx(s.db.WithContext(ctx), session)
+}
+
+func (s *Store) GetSessionTx(db *gorm.DB, session int64) (*perm.SessionInfo, error) {
+	var ret *perm.SessionInfo
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		dbSession := &model.Session{}
+		if err := tx.Where("id = ?", session).First(dbSession).Error; err != nil {
+			return SessionErr(err)
+		}
+		ret = &perm.SessionInfo{
+			CreatedAt: dbSession.CreatedAt,
+			Session:   dbSession.ID,
+			Domain:    dbSession.Domain,
+			User:      dbSession.UserID,
+		}
+		return tx.Model(&model.SessionRole{}).Where("session = ?", session).Order("role").Pluck("role", &ret.Roles).Error
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Store) ListSessionRoles(ctx context.Context, session int64) ([]perm.Role, error) {
+	return s.ListSessionRolesTx(s.db.WithContext(ctx), session)
+}
+
+func (s *Store) ListSessionRolesTx(db *gorm.DB, session int64) ([]perm.Role, error) {
+	var roles []perm.Role
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", session).First(&model.Session{}).Error; err != nil {
+			return SessionErr(err)
+		}
+		return tx.Model(&model.SessionRole{}).Where("session = ?", session).Order("role").Pluck("role", &roles).Error
+	}); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *Store) DeleteSession(ctx context.Context, session int64) error {
+	return s.DeleteSessionTx(s.db.WithContext(ctx), session)
+}
+
+func (s *Store) DeleteSessionTx(db *gorm.DB, session int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("session = ?", session).Delete(&model.SessionRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", session).Delete(&model.Session{}).Error
+	})
+}
+
+func (s *Store) CheckSessionPerm(ctx context.Context, session int64, obj perm.Obj, act perm.Act) (bool, error) {
+	return s.CheckSessionPermTx(s.db.WithContext(ctx), session, obj, act)
+}
+
+func (s *Store) CheckSessionPermTx(db *gorm.DB, session int64, obj perm.Obj, act perm.Act) (bool, error) {
+	dbSession := &model.Session{}
+	if err := db.Where("id = ?", session).First(dbSession).Error; err != nil {
+		return false, SessionErr(err)
+	}
+	roles, err := s.ListSessionRolesTx(db, session)
+	if err != nil {
+		return false, err
+	}
+	return s.b.CheckPermsTx(db, dbSession.Domain, roles, obj, act)
+}
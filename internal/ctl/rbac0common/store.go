@@ -0,0 +1,94 @@
+package rbac0common
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
+	"gorm.io/gorm"
+)
+
+// Backend 各实现提供的角色权限、继承关系与权限检查
+type Backend interface {
+	GetRolePermsTx(db *gorm.DB, role perm.Role) (*perm.RolePerms, error)
+	ListAncestorsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error)
+	ListDescendantsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error)
+	CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error)
+	// FilterPermRoles 在角色表的查询db上过滤出直接授予了q.Obj/q.Act允许权限的角色，见 perm.RoleQuery
+	FilterPermRoles(db *gorm.DB, q *perm.RoleQuery) (*gorm.DB, error)
+}
+
+// Store 各实现共用的存储：角色信息、用户角色分配、会话、职责分离约束与审计日志
+// 由实现嵌入，角色权限与继承关系的存储及权限检查由实现通过 Backend 提供
+type Store struct {
+	db *gorm.DB
+	b  Backend
+
+	wMu sync.RWMutex
+	w   watcher.Watcher
+}
+
+func NewStore(db *gorm.DB, b Backend) *Store {
+	return &Store{db: db, b: b}
+}
+
+// SetWatcher 替换Watcher，之前设置的Watcher被关闭
+func (s *Store) SetWatcher(w watcher.Watcher) {
+	s.wMu.Lock()
+	old := s.w
+	s.w = w
+	s.wMu.Unlock()
+	if old != nil && old != w {
+		_ = old.Close()
+	}
+}
+
+// Watcher SetWatcher 设置的Watcher，未设置时为nil
+func (s *Store) Watcher() watcher.Watcher {
+	s.wMu.RLock()
+	defer s.wMu.RUnlock()
+	return s.w
+}
+
+func (s *Store) ListAuditLogs(ctx context.Context, q audit.Query) ([]*audit.Entry, int64, error) {
+	return s.ListAuditLogsTx(s.db.WithContext(ctx), q)
+}
+
+func (s *Store) ListAuditLogsTx(db *gorm.DB, q audit.Query) ([]*audit.Entry, int64, error) {
+	return audit.List(db, q)
+}
+
+// Publish 在tx中发布roles的变更，roles为空表示全部角色
+func (s *Store) Publish(tx *gorm.DB, roles ...perm.Role) error {
+	w := s.Watcher()
+	if w == nil {
+		return nil
+	}
+	return w.Publish(tx, watcher.Event{Roles: roles})
+}
+
+// Snapshot 在tx中查询role当前的角色权限，用于审计日志，角色不存在时返回nil
+func (s *Store) Snapshot(tx *gorm.DB, role perm.Role) (*perm.RolePerms, error) {
+	ret, err := s.b.GetRolePermsTx(tx, role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return ret, err
+}
+
+// AuditRole 在tx中记录对e.Role的修改，e.Before为修改前的 Snapshot，修改后的角色权限在此查询
+// 修改前后角色均不存在(修改未生效)时不记录
+func (s *Store) AuditRole(tx *gorm.DB, e *audit.Entry) error {
+	after, err := s.Snapshot(tx, e.Role)
+	if err != nil {
+		return err
+	}
+	if e.Before == nil && after == nil {
+		return nil
+	}
+	e.After = after
+	return audit.Record(tx, e)
+}
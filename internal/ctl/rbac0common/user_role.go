@@ -0,0 +1,125 @@
+package rbac0common
+
+import (
+	"context"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+func (s *Store) AssignUserRoles(ctx context.Context, user int64, roles []perm.Role) error {
+	return s.AssignUserRolesTx(s.db.WithContext(ctx), user, roles)
+}
+
+func (s *Store) AssignUserRolesTx(db *gorm.DB, user int64, roles []perm.Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var assigned []perm.Role
+		if err := tx.Model(&model.UserRole{}).Where("user_id = ?", user).Pluck("role", &assigned).Error; err != nil {
+			return err
+		}
+		exist := make(map[perm.Role]bool, len(assigned)+len(roles))
+		for _, role := range assigned {
+			exist[role] = true
+		}
+		var newUserRoles []*model.UserRole
+		for _, role := range roles {
+			if exist[role] {
+				continue
+			}
+			if err := tx.Where("id = ?", role).First(&model.Role{}).Error; err != nil {
+				return RoleErr(err)
+			}
+			exist[role] = true
+			newUserRoles = append(newUserRoles, &model.UserRole{
+				UserID: user,
+				Role:   role,
+			})
+		}
+		if len(newUserRoles) == 0 {
+			return nil
+		}
+		if err := tx.Create(newUserRoles).Error; err != nil {
+			return err
+		}
+		for _, newUserRole := range newUserRoles {
+			if err := audit.Record(tx, &audit.Entry{Action: audit.ActionAssignUserRoles, Role: newUserRole.Role, User: user}); err != nil {
+				return err
+			}
+		}
+		return s.CheckUserSSD(tx, user)
+	})
+}
+
+func (s *Store) DeassignUserRoles(ctx context.Context, user int64, roles []perm.Role) error {
+	return s.DeassignUserRolesTx(s.db.WithContext(ctx), user, roles)
+}
+
+func (s *Store) DeassignUserRolesTx(db *gorm.DB, user int64, roles []perm.Role) error {
+	if len(roles) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role IN ? AND session IN (?)", roles,
+			tx.Model(&model.Session{}).Select("id").Where("user_id = ?", user)).Delete(&model.SessionRole{}).Error; err != nil {
+			return err
+		}
+		var assigned []perm.Role
+		if err := tx.Model(&model.UserRole{}).Where("user_id = ? AND role IN ?", user, roles).Order("role").Pluck("role", &assigned).Error; err != nil {
+			return err
+		}
+		if len(assigned) == 0 {
+			return nil
+		}
+		if err := tx.Where("user_id = ? AND role IN ?", user, assigned).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+		for _, role := range assigned {
+			if err := audit.Record(tx, &audit.Entry{Action: audit.ActionDeassignUserRoles, Role: role, User: user}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) ListUserRoles(ctx context.Context, user int64) ([]perm.Role, error) {
+	return s.ListUserRolesTx(s.db.WithContext(ctx), user)
+}
+
+func (s *Store) ListUserRolesTx(db *gorm.DB, user int64) ([]perm.Role, error) {
+	var roles []perm.Role
+	if err := db.Model(&model.UserRole{}).Where("user_id = ?", user).Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (s *Store) ListRoleUsers(ctx context.Context, role perm.Role) ([]int64, error) {
+	return s.ListRoleUsersTx(s.db.WithContext(ctx), role)
+}
+
+func (s *Store) ListRoleUsersTx(db *gorm.DB, role perm.Role) ([]int64, error) {
+	var users []int64
+	if err := db.Model(&model.UserRole{}).Where("role = ?", role).Order("user_id").Pluck("user_id", &users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *Store) CheckUserPerm(ctx context.Context, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error) {
+	return s.CheckUserPermTx(s.db.WithContext(ctx), domain, user, obj, act)
+}
+
+func (s *Store) CheckUserPermTx(db *gorm.DB, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error) {
+	var roles []perm.Role
+	if err := db.Model(&model.Role{}).Where("domain IN ? AND id IN (?)", DomainScope(domain),
+		db.Model(&model.UserRole{}).Select("role").Where("user_id = ?", user)).Order("id").Pluck("id", &roles).Error; err != nil {
+		return false, err
+	}
+	return s.b.CheckPermsTx(db, domain, roles, obj, act)
+}
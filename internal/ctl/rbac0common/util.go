@@ -0,0 +1,125 @@
+package rbac0common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+// RoleErr 角色不存在的存储层错误包装为 errs.ErrRoleNotFound，仍可通过 errors.Is 判断 gorm.ErrRecordNotFound
+func RoleErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, errs.ErrRoleNotFound) {
+		return fmt.Errorf("%w: %w", errs.ErrRoleNotFound, err)
+	}
+	return err
+}
+
+// SessionErr 会话不存在的存储层错误包装为 errs.ErrSessionNotFound，仍可通过 errors.Is 判断 gorm.ErrRecordNotFound
+func SessionErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, errs.ErrSessionNotFound) {
+		return fmt.Errorf("%w: %w", errs.ErrSessionNotFound, err)
+	}
+	return err
+}
+
+// ConstraintErr 职责分离约束不存在的存储层错误包装为 errs.ErrConstraintNotFound，仍可通过 errors.Is 判断 gorm.ErrRecordNotFound
+func ConstraintErr(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, errs.ErrConstraintNotFound) {
+		return fmt.Errorf("%w: %w", errs.ErrConstraintNotFound, err)
+	}
+	return err
+}
+
+// DomainScope 在domain中生效的域：全局域与domain自身
+func DomainScope(domain perm.Domain) []perm.Domain {
+	if domain == perm.GlobalDomain {
+		return []perm.Domain{perm.GlobalDomain}
+	}
+	return []perm.Domain{perm.GlobalDomain, domain}
+}
+
+// ValidatePerms 校验权限的域与条件表达式
+func ValidatePerms(perms []perm.Perm) error {
+	for _, p := range perms {
+		if err := p.Domain.Validate(); err != nil {
+			return err
+		}
+		if err := p.ValidateCond(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScopePerms 域角色的权限限定在角色所在的域，未指定域的权限归属角色所在的域
+func ScopePerms(dbRole *model.Role, perms []perm.Perm) ([]perm.Perm, error) {
+	if dbRole.Domain == perm.GlobalDomain {
+		return perms, nil
+	}
+	rets := make([]perm.Perm, 0, len(perms))
+	for _, p := range perms {
+		if p.Domain == perm.GlobalDomain {
+			p.Domain = dbRole.Domain
+		} else if p.Domain != dbRole.Domain {
+			return nil, errs.ErrPermDomainMismatch
+		}
+		rets = append(rets, p)
+	}
+	return rets, nil
+}
+
+// FilterDomainPerms 过滤出在domain中生效的权限
+func FilterDomainPerms(perms []perm.Perm, domain perm.Domain) []perm.Perm {
+	var rets []perm.Perm
+	for _, p := range perms {
+		if p.Domain == perm.GlobalDomain || p.Domain == domain {
+			rets = append(rets, p)
+		}
+	}
+	return rets
+}
+
+// ToInheritedPerms 过滤掉与直接授予的权限重复的继承权限
+func ToInheritedPerms(perms, inheritedPerms []perm.Perm) []perm.Perm {
+	var rets []perm.Perm
+	exist := make(map[perm.Perm]bool, len(perms)+len(inheritedPerms))
+	for _, p := range perms {
+		exist[p] = true
+	}
+	for _, p := range inheritedPerms {
+		if !exist[p] {
+			exist[p] = true
+			rets = append(rets, p)
+		}
+	}
+	return rets
+}
+
+func UniqueRoles(roles []perm.Role) []perm.Role {
+	var rets []perm.Role
+	exist := make(map[perm.Role]bool, len(roles))
+	for _, role := range roles {
+		if !exist[role] {
+			exist[role] = true
+			rets = append(rets, role)
+		}
+	}
+	return rets
+}
+
+func ToRoleInfo(dbRole *model.Role) *perm.RoleInfo {
+	return &perm.RoleInfo{
+		CreatedAt: dbRole.CreatedAt,
+		Domain:    dbRole.Domain,
+		Role:      perm.Role(dbRole.ID),
+		Enable:    dbRole.Enable,
+		IsAdmin:   dbRole.IsAdmin,
+		Creator:   dbRole.Creator,
+		Name:      dbRole.Name,
+		Desc:      dbRole.Desc,
+	}
+}
@@ -0,0 +1,88 @@
+package cursor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Cursor 游标分页的位置：上一页最后一条记录的排序字段值与id
+// 编码为不透明的字符串返回给调用方，下一页从该位置之后开始，不受并发插入影响
+type Cursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d,omitempty"`
+	Value interface{} `json:"v,omitempty"`
+	ID    int64       `json:"i"`
+}
+
+// Encode 编码为URL安全的字符串
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode 解码 Encode 的结果，sort/desc须与编码时一致，否则返回 errs.ErrInvalidCursor
+func Decode(s, sort string, desc bool) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidCursor, err)
+	}
+	c := &Cursor{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(c); err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidCursor, err)
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, fmt.Errorf("%w: sort mismatch", errs.ErrInvalidCursor)
+	}
+	if n, ok := c.Value.(json.Number); ok {
+		if c.Value, err = n.Int64(); err != nil {
+			return nil, fmt.Errorf("%w: %w", errs.ErrInvalidCursor, err)
+		}
+	}
+	return c, nil
+}
+
+// After 在db上添加位于c之后的条件：按sort排序，相同时按id排序(id为主键)
+func (c *Cursor) After(db *gorm.DB) *gorm.DB {
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+	id := clause.Column{Table: clause.CurrentTable, Name: "id"}
+	if c.Sort == "id" {
+		return db.Where("? "+op+" ?", id, c.ID)
+	}
+	col := clause.Column{Table: clause.CurrentTable, Name: c.Sort}
+	return db.Where("(? "+op+" ?) OR (? = ? AND ? "+op+" ?)", col, c.Value, col, c.Value, id, c.ID)
+}
+
+// Role dbRole作为按sortBy排序的最后一条记录的位置
+func Role(dbRole *model.Role, sortBy perm.RoleSortField, desc bool) *Cursor {
+	c := &Cursor{Sort: string(sortBy), Desc: desc, ID: dbRole.ID}
+	switch sortBy {
+	case perm.RoleSortCreatedAt:
+		c.Value = dbRole.CreatedAt
+	case perm.RoleSortUpdatedAt:
+		c.Value = dbRole.UpdatedAt
+	case perm.RoleSortDomain:
+		c.Value = dbRole.Domain
+	case perm.RoleSortEnable:
+		c.Value = dbRole.Enable
+	case perm.RoleSortIsAdmin:
+		c.Value = dbRole.IsAdmin
+	case perm.RoleSortCreator:
+		c.Value = dbRole.Creator
+	case perm.RoleSortName:
+		c.Value = dbRole.Name
+	}
+	return c
+}
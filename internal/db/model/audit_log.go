@@ -0,0 +1,22 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// AuditLog 角色与权限修改审计日志 DB model
+type AuditLog struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli;index:idx_audit_log_created_at;not null"`
+	// 操作用户id，为0表示未知(例如系统任务)
+	Actor int64 `gorm:"index:idx_audit_log_actor;not null"`
+	// 操作类型
+	Action string `gorm:"size:64;not null"`
+	// 被修改的角色，为0表示不针对单个角色(例如职责分离约束)
+	Role perm.Role `gorm:"index:idx_audit_log_role;not null;default:0"`
+	// 被分配/撤销角色的用户id
+	UserID int64 `gorm:"not null;default:0"`
+	// 操作详情
+	Detail string `gorm:"size:1024;not null;default:''"`
+	// 修改前后的角色权限(JSON)，为空表示角色不存在
+	BeforePerms string `gorm:"type:text"`
+	AfterPerms  string `gorm:"type:text"`
+}
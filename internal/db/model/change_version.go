@@ -0,0 +1,11 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// ChangeVersion 角色变更版本 DB model，用于跨实例的变更通知
+type ChangeVersion struct {
+	// 发生变更的角色，为0表示全部角色
+	Role perm.Role `gorm:"primary_key;autoIncrement:false"`
+	// 每次变更递增
+	Version int64 `gorm:"not null"`
+}
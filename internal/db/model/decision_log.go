@@ -0,0 +1,24 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// DecisionLog 权限检查判定日志 DB model
+type DecisionLog struct {
+	ID int64 `gorm:"primary_key"`
+	// 检查开始时间(unix毫秒)
+	Time int64 `gorm:"index:idx_decision_log_time;not null"`
+	// 调用方的请求id
+	RequestID string      `gorm:"size:128;index:idx_decision_log_request_id;not null;default:''"`
+	Domain    perm.Domain `gorm:"not null;default:''"`
+	// 参与检查的角色(JSON)
+	Roles     string   `gorm:"size:1024;not null;default:''"`
+	UserID    int64    `gorm:"not null;default:0"`
+	SessionID int64    `gorm:"not null;default:0"`
+	Obj       perm.Obj `gorm:"not null"`
+	Act       perm.Act `gorm:"not null"`
+	Allowed   bool     `gorm:"index:idx_decision_log_allowed;not null"`
+	Reason    string   `gorm:"size:32;not null;default:''"`
+	// 检查耗时(纳秒)
+	Latency int64  `gorm:"not null"`
+	Error   string `gorm:"size:1024;not null;default:''"`
+}
@@ -1,10 +1,14 @@
 package model
 
+import "github.com/gromitlee/access/pkg/perm"
+
 // Role 角色 DB model
 type Role struct {
 	ID        int64 `gorm:"primary_key"`
 	CreatedAt int64 `gorm:"autoCreateTime:milli;not null"`
 	UpdatedAt int64 `gorm:"autoUpdateTime:milli;not null"`
+	// 所属域，为空表示全局角色
+	Domain perm.Domain `gorm:"index:idx_role_domain;not null;default:''"`
 	// 是否启用
 	Enable bool `gorm:"index:idx_role_enable;not null"`
 	// 是否admin
@@ -0,0 +1,11 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// RoleInheritance 角色继承 DB model，Parent 继承 Child 的所有权限
+type RoleInheritance struct {
+	ID int64 `gorm:"primary_key"`
+
+	Parent perm.Role `gorm:"uniqueIndex:uidx_role_inheritance_parent_child;not null"`
+	Child  perm.Role `gorm:"uniqueIndex:uidx_role_inheritance_parent_child;index:idx_role_inheritance_child;not null"`
+}
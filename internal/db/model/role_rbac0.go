@@ -6,7 +6,15 @@ import "github.com/gromitlee/access/pkg/perm"
 type RolePerm struct {
 	ID int64 `gorm:"primary_key"`
 
-	Role perm.Role `gorm:"index:idx_role_perm_role;not null"`
-	Obj  perm.Obj  `gorm:"index:idx_role_perm_obj;not null"`
-	Act  perm.Act  `gorm:"index:idx_role_perm_act;not null"`
+	Role   perm.Role   `gorm:"index:idx_role_perm_role;not null"`
+	Domain perm.Domain `gorm:"index:idx_role_perm_domain;not null;default:''"`
+	Obj    perm.Obj    `gorm:"index:idx_role_perm_obj;not null"`
+	Act    perm.Act    `gorm:"index:idx_role_perm_act;not null"`
+	Effect perm.Effect `gorm:"not null;default:0"`
+	// 生效时间，为0表示立即生效
+	NotBefore int64 `gorm:"not null;default:0"`
+	// 过期时间，为0表示永不过期
+	ExpiresAt int64 `gorm:"index:idx_role_perm_expires_at;not null;default:0"`
+	// 条件表达式，为空表示无条件
+	Cond string `gorm:"size:1024;not null;default:''"`
 }
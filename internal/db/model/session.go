@@ -0,0 +1,21 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// Session 会话 DB model
+type Session struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli;not null"`
+	// 会话所属用户id
+	UserID int64 `gorm:"index:idx_session_user_id;not null"`
+	// 会话所在域
+	Domain perm.Domain `gorm:"not null;default:''"`
+}
+
+// SessionRole 会话激活角色 DB model
+type SessionRole struct {
+	ID int64 `gorm:"primary_key"`
+
+	Session int64     `gorm:"uniqueIndex:uidx_session_role_session_role;not null"`
+	Role    perm.Role `gorm:"uniqueIndex:uidx_session_role_session_role;index:idx_session_role_role;not null"`
+}
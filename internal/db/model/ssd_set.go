@@ -0,0 +1,21 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// SSDSet 静态职责分离(Static Separation of Duty)约束 DB model
+type SSDSet struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli;not null"`
+	// 约束名
+	Name string `gorm:"uniqueIndex:uidx_ssd_set_name;not null"`
+	// 用户被授权的角色中，属于该约束的角色数量不得达到Cardinality
+	Cardinality int `gorm:"not null"`
+}
+
+// SSDSetRole 静态职责分离约束包含的角色 DB model
+type SSDSetRole struct {
+	ID int64 `gorm:"primary_key"`
+
+	SetID int64     `gorm:"uniqueIndex:uidx_ssd_set_role_set_id_role;not null"`
+	Role  perm.Role `gorm:"uniqueIndex:uidx_ssd_set_role_set_id_role;index:idx_ssd_set_role_role;not null"`
+}
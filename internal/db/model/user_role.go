@@ -0,0 +1,13 @@
+package model
+
+import "github.com/gromitlee/access/pkg/perm"
+
+// UserRole 用户角色分配 DB model
+type UserRole struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt int64 `gorm:"autoCreateTime:milli;not null"`
+	// 用户id（考虑到用户可以被删除，因此不做外键关联）
+	UserID int64 `gorm:"uniqueIndex:uidx_user_role_user_id_role;not null"`
+	// 角色
+	Role perm.Role `gorm:"uniqueIndex:uidx_user_role_user_id_role;index:idx_user_role_role;not null"`
+}
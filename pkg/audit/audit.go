@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+// Action 审计的操作类型
+type Action string
+
+const (
+	ActionCreateRole        Action = "create_role"
+	ActionUpdateRole        Action = "update_role"
+	ActionDeleteRole        Action = "delete_role"
+	ActionEnableRole        Action = "enable_role"
+	ActionDisableRole       Action = "disable_role"
+	ActionGrantPerms        Action = "grant_perms"
+	ActionRevokePerms       Action = "revoke_perms"
+	ActionCleanPerms        Action = "clean_perms"
+	ActionSweepExpiredPerms Action = "sweep_expired_perms"
+	ActionAssignUserRoles   Action = "assign_user_roles"
+	ActionDeassignUserRoles Action = "deassign_user_roles"
+	ActionAddInheritance    Action = "add_inheritance"
+	ActionDeleteInheritance Action = "delete_inheritance"
+	ActionCreateSSDSet      Action = "create_ssd_set"
+	ActionDeleteSSDSet      Action = "delete_ssd_set"
+	ActionCreateDSDSet      Action = "create_dsd_set"
+	ActionDeleteDSDSet      Action = "delete_dsd_set"
+)
+
+// Entry 审计日志
+type Entry struct {
+	ID        int64 `json:"id"`
+	CreatedAt int64 `json:"created_at"`
+	// 操作用户id，见 WithActor
+	Actor  int64  `json:"actor"`
+	Action Action `json:"action"`
+	// 被修改的角色，为0表示不针对单个角色(例如职责分离约束)
+	Role perm.Role `json:"role,omitempty"`
+	// 被分配/撤销角色的用户id(ActionAssignUserRoles / ActionDeassignUserRoles)
+	User int64 `json:"user,omitempty"`
+	// 操作详情，例如继承的角色、约束的名称与角色
+	Detail string `json:"detail,omitempty"`
+	// 修改前后的角色权限，角色不存在或操作不涉及角色权限时为nil
+	Before *perm.RolePerms `json:"before,omitempty"`
+	After  *perm.RolePerms `json:"after,omitempty"`
+}
+
+// Query 审计日志查询条件，零值表示不过滤
+type Query struct {
+	Role   perm.Role
+	Actor  int64
+	Action Action
+	// 时间范围 [Since, Until)，unix毫秒
+	Since int64
+	Until int64
+	// 分页，limit为-1表示不分页；order小于0时按时间倒序
+	Offset int64
+	Limit  int64
+	Order  int64
+}
+
+type actorKey struct{}
+
+// WithActor 在ctx中设置操作用户id，修改角色与权限时(包括Tx方法的 db.WithContext(ctx))记录到审计日志
+func WithActor(ctx context.Context, actor int64) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext 获取ctx中的操作用户id，未设置时为0
+func ActorFromContext(ctx context.Context) int64 {
+	if ctx == nil {
+		return 0
+	}
+	actor, _ := ctx.Value(actorKey{}).(int64)
+	return actor
+}
+
+// Record 在db中记录审计日志，控制器在修改角色与权限的事务中调用
+// e.Actor为0时取db的ctx中的操作用户id
+func Record(db *gorm.DB, e *Entry) error {
+	if e.Actor == 0 {
+		e.Actor = ActorFromContext(db.Statement.Context)
+	}
+	before, err := marshalRolePerms(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshalRolePerms(e.After)
+	if err != nil {
+		return err
+	}
+	dbLog := &model.AuditLog{
+		Actor:       e.Actor,
+		Action:      string(e.Action),
+		Role:        e.Role,
+		UserID:      e.User,
+		Detail:      e.Detail,
+		BeforePerms: before,
+		AfterPerms:  after,
+	}
+	if err = db.Create(dbLog).Error; err != nil {
+		return err
+	}
+	e.ID = dbLog.ID
+	e.CreatedAt = dbLog.CreatedAt
+	return nil
+}
+
+// List 按条件查询审计日志，返回日志与总数
+func List(db *gorm.DB, q Query) ([]*Entry, int64, error) {
+	if q.Offset < 0 || (q.Limit <= 0 && q.Limit != -1) {
+		return nil, 0, errs.ErrInvalidPagination
+	}
+	if q.Role != 0 {
+		db = db.Where("role = ?", q.Role)
+	}
+	if q.Actor != 0 {
+		db = db.Where("actor = ?", q.Actor)
+	}
+	if q.Action != "" {
+		db = db.Where("action = ?", q.Action)
+	}
+	if q.Since != 0 {
+		db = db.Where("created_at >= ?", q.Since)
+	}
+	if q.Until != 0 {
+		db = db.Where("created_at < ?", q.Until)
+	}
+	if q.Order < 0 {
+		db = db.Order("id desc")
+	} else {
+		db = db.Order("id")
+	}
+	var dbLogs []*model.AuditLog
+	var count int64
+	if err := db.Model(&model.AuditLog{}).
+		Offset(int(q.Offset)).Limit(int(q.Limit)).Find(&dbLogs).
+		Offset(-1).Limit(-1).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	var rets []*Entry
+	for _, dbLog := range dbLogs {
+		e := &Entry{
+			ID:        dbLog.ID,
+			CreatedAt: dbLog.CreatedAt,
+			Actor:     dbLog.Actor,
+			Action:    Action(dbLog.Action),
+			Role:      dbLog.Role,
+			User:      dbLog.UserID,
+			Detail:    dbLog.Detail,
+		}
+		var err error
+		if e.Before, err = unmarshalRolePerms(dbLog.BeforePerms); err != nil {
+			return nil, 0, err
+		}
+		if e.After, err = unmarshalRolePerms(dbLog.AfterPerms); err != nil {
+			return nil, 0, err
+		}
+		rets = append(rets, e)
+	}
+	return rets, count, nil
+}
+
+// --- internal function ---
+
+func marshalRolePerms(rp *perm.RolePerms) (string, error) {
+	if rp == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(rp)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func unmarshalRolePerms(s string) (*perm.RolePerms, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rp := &perm.RolePerms{}
+	if err := json.Unmarshal([]byte(s), rp); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
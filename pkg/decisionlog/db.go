@@ -0,0 +1,51 @@
+package decisionlog
+
+import (
+	"encoding/json"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"gorm.io/gorm"
+)
+
+// DBSink 写入数据库判定日志表的 Sink，适用于任意gorm支持的数据库
+// 判定日志在独立的连接中写入，不受调用方事务回滚的影响
+type DBSink struct {
+	db *gorm.DB
+}
+
+// NewDBSink 创建数据库 Sink，自动创建判定日志表
+func NewDBSink(db *gorm.DB) (*DBSink, error) {
+	if err := db.AutoMigrate(model.DecisionLog{}); err != nil {
+		return nil, err
+	}
+	return &DBSink{db: db}, nil
+}
+
+func (s *DBSink) Write(r *Record) error {
+	var roles string
+	if len(r.Roles) > 0 {
+		data, err := json.Marshal(r.Roles)
+		if err != nil {
+			return err
+		}
+		roles = string(data)
+	}
+	return s.db.Create(&model.DecisionLog{
+		Time:      r.Time,
+		RequestID: r.RequestID,
+		Domain:    r.Domain,
+		Roles:     roles,
+		UserID:    r.User,
+		SessionID: r.Session,
+		Obj:       r.Obj,
+		Act:       r.Act,
+		Allowed:   r.Allowed,
+		Reason:    r.Reason,
+		Latency:   int64(r.Latency),
+		Error:     r.Error,
+	}).Error
+}
+
+func (s *DBSink) Close() error {
+	return nil
+}
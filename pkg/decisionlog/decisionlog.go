@@ -0,0 +1,102 @@
+package decisionlog
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gromitlee/access/pkg/perm"
+)
+
+// Record 一次权限检查的判定日志
+type Record struct {
+	// 检查开始时间(unix毫秒)
+	Time int64 `json:"time"`
+	// 调用方的请求id，见 WithRequestID
+	RequestID string      `json:"request_id,omitempty"`
+	Domain    perm.Domain `json:"domain"`
+	// 参与检查的角色，CheckUserPerm / CheckSessionPerm 为空，见User / Session
+	Roles   []perm.Role `json:"roles,omitempty"`
+	User    int64       `json:"user,omitempty"`
+	Session int64       `json:"session,omitempty"`
+	Obj     perm.Obj    `json:"obj"`
+	Act     perm.Act    `json:"act"`
+	Allowed bool        `json:"allowed"`
+	// 判定原因，仅 Decide / DecideMany 有
+	Reason  string        `json:"reason,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+	// 检查出错时的错误信息，此时Allowed为false
+	Error string `json:"error,omitempty"`
+}
+
+// Sink 判定日志的输出
+type Sink interface {
+	// Write 写入判定日志，在检查的goroutine中同步调用，须goroutine safe
+	Write(r *Record) error
+	Close() error
+}
+
+// Options 判定日志选项
+type Options struct {
+	// 采样率，取值(0, 1]，为0时记录全部
+	SampleRate float64
+	// 只记录拒绝(含出错)的检查，与采样同时设置时对拒绝的检查采样
+	DenyOnly bool
+	// Sink写入失败时回调，为nil时忽略
+	OnError func(error)
+}
+
+// Logger 判定日志记录器
+type Logger struct {
+	sink Sink
+	opts Options
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewLogger 创建判定日志记录器，日志写入sink
+func NewLogger(sink Sink, opts Options) *Logger {
+	return &Logger{sink: sink, opts: opts}
+}
+
+// Log 按选项过滤与采样后写入r，r.RequestID为空时取ctx中的请求id
+func (l *Logger) Log(ctx context.Context, r *Record) {
+	if l.opts.DenyOnly && r.Allowed {
+		return
+	}
+	if l.opts.SampleRate > 0 && l.opts.SampleRate < 1 && rand.Float64() >= l.opts.SampleRate {
+		return
+	}
+	if r.RequestID == "" {
+		r.RequestID = RequestIDFromContext(ctx)
+	}
+	if err := l.sink.Write(r); err != nil && l.opts.OnError != nil {
+		l.opts.OnError(err)
+	}
+}
+
+// Close 关闭Sink，可重复调用
+func (l *Logger) Close() error {
+	l.closeOnce.Do(func() {
+		l.closeErr = l.sink.Close()
+	})
+	return l.closeErr
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 在ctx中设置请求id，检查时(包括Tx方法的 db.WithContext(ctx))记录到判定日志
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext 获取ctx中的请求id，未设置时为空
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
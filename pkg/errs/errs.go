@@ -0,0 +1,52 @@
+package errs
+
+import "errors"
+
+// 控制器API返回的错误，通过 errors.Is 判断，access与casbin实现一致
+// 由存储层错误转换而来的错误仍包装原错误(例如角色不存在时同时为 gorm.ErrRecordNotFound)
+var (
+	// ErrNotInitialized 单例控制器未初始化
+	ErrNotInitialized = errors.New("rbac0 ctl not init")
+	// ErrAlreadyInitialized 单例控制器已初始化，或判定日志已启用
+	ErrAlreadyInitialized = errors.New("rbac0 ctl already init")
+	// ErrClosed 控制器已关闭，见 Health
+	ErrClosed = errors.New("rbac0 ctl closed")
+	// ErrRoleNotFound 角色不存在，或在检查的域中不可见
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists 创建角色时指定的角色已存在
+	ErrRoleExists = errors.New("role already exists")
+	// ErrInvalidDomain 域不合法，"*"保留用于表示全局域，见 perm.Domain.Validate
+	ErrInvalidDomain = errors.New("invalid domain")
+	// ErrSessionNotFound 会话不存在
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrRoleNotAssigned 会话激活的角色未分配给会话所属用户
+	ErrRoleNotAssigned = errors.New("role not assigned to session user")
+	// ErrRoleNotInDomain 会话激活的角色在会话所在域中不生效
+	ErrRoleNotInDomain = errors.New("role not in session domain")
+	// ErrPermDomainMismatch 授予域角色的权限不属于角色所在的域
+	ErrPermDomainMismatch = errors.New("perm domain mismatch")
+	// ErrInheritanceCycle 添加的角色继承关系会形成环
+	ErrInheritanceCycle = errors.New("role inheritance cycle")
+	// ErrInheritanceAcrossDomains 添加的角色继承关系跨越不同的域
+	ErrInheritanceAcrossDomains = errors.New("role inheritance across domains")
+	// ErrConstraintNotFound 职责分离约束不存在
+	ErrConstraintNotFound = errors.New("constraint not found")
+	// ErrInvalidConstraint 职责分离约束不合法，例如cardinality不在2与角色数之间
+	ErrInvalidConstraint = errors.New("invalid constraint")
+	// ErrSSDViolation 违反静态职责分离约束，详细信息见 perm.SSDViolationError
+	ErrSSDViolation = errors.New("ssd violation")
+	// ErrDSDViolation 违反动态职责分离约束，详细信息见 perm.DSDViolationError
+	ErrDSDViolation = errors.New("dsd violation")
+	// ErrNotSupported 控制器不支持的操作，例如access实现注册matcher函数
+	ErrNotSupported = errors.New("not supported")
+	// ErrRoleDisabled 角色未启用，见 perm.Decision.Err
+	ErrRoleDisabled = errors.New("role disabled")
+	// ErrPermissionDenied 没有权限或被拒绝权限匹配，见 perm.Decision.Err
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvalidPagination 分页参数(offset/limit)不合法
+	ErrInvalidPagination = errors.New("invalid offset or limit")
+	// ErrInvalidQuery 查询条件不合法，见 perm.RoleQuery.Validate
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidCursor 分页游标无法解析，或与查询的排序条件不一致
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
@@ -0,0 +1,76 @@
+package perm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/casbin/govaluate"
+)
+
+// condExprs 已解析的条件表达式，按表达式字符串缓存，避免每次检查权限时重新解析
+// 表达式在授予权限时已校验，数量与授予的不同条件数相同
+var condExprs sync.Map
+
+// condExpr 解析条件表达式，结果按表达式字符串缓存
+func condExpr(cond string) (*govaluate.EvaluableExpression, error) {
+	if expr, ok := condExprs.Load(cond); ok {
+		return expr.(*govaluate.EvaluableExpression), nil
+	}
+	expr, err := govaluate.NewEvaluableExpression(cond)
+	if err != nil {
+		return nil, err
+	}
+	condExprs.Store(cond, expr)
+	return expr, nil
+}
+
+// ValidateCond 校验权限p的条件表达式能否被解析
+func (p Perm) ValidateCond() error {
+	if p.Cond == "" {
+		return nil
+	}
+	if _, err := condExpr(p.Cond); err != nil {
+		return fmt.Errorf("invalid perm cond %q: %w", p.Cond, err)
+	}
+	return nil
+}
+
+// MatchCond 判断权限p的条件在attrs下是否成立，无条件的权限总是成立
+// 条件表达式语法与casbin matcher一致(govaluate)，例如 "amount < 10000 && region == 'eu'"
+// 表达式结果不是bool或缺少所需属性时返回错误
+func (p Perm) MatchCond(attrs map[string]interface{}) (bool, error) {
+	if p.Cond == "" {
+		return true, nil
+	}
+	expr, err := condExpr(p.Cond)
+	if err != nil {
+		return false, err
+	}
+	ret, err := expr.Evaluate(attrs)
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := ret.(bool)
+	if !isBool {
+		return false, fmt.Errorf("perm cond %q result is not bool", p.Cond)
+	}
+	return ok, nil
+}
+
+// Applies 判断权限p在now(毫秒时间戳)与attrs下是否参与obj与act的权限判断
+// 条件无法求值时，允许权限视为不参与，拒绝权限视为参与(fail closed)
+func (p Perm) Applies(obj Obj, act Act, now int64, attrs map[string]interface{}) bool {
+	return p.Match(obj, act) && p.Effective(now, attrs)
+}
+
+// Effective 同 Applies，不判断obj与act
+func (p Perm) Effective(now int64, attrs map[string]interface{}) bool {
+	if !p.Active(now) {
+		return false
+	}
+	ok, err := p.MatchCond(attrs)
+	if err != nil {
+		return p.Effect == EffectDeny
+	}
+	return ok
+}
@@ -0,0 +1,59 @@
+package perm
+
+import (
+	"fmt"
+
+	"github.com/gromitlee/access/pkg/errs"
+)
+
+// SSDSet 静态职责分离(Static Separation of Duty)约束
+// 用户被授权的角色(含继承角色)中，属于Roles的角色数量不得达到Cardinality
+type SSDSet struct {
+	CreatedAt   int64
+	Name        string
+	Roles       []Role
+	Cardinality int
+}
+
+// SSDViolationError 违反静态职责分离约束的详细信息，errors.Is(err, errs.ErrSSDViolation) 为true
+type SSDViolationError struct {
+	// 被违反的约束名
+	Set         string
+	Cardinality int
+	// 相互冲突的角色
+	Roles []Role
+}
+
+func (e *SSDViolationError) Error() string {
+	return fmt.Sprintf("ssd violation: set %s forbids %d or more of roles %v", e.Set, e.Cardinality, e.Roles)
+}
+
+func (e *SSDViolationError) Is(target error) bool {
+	return target == errs.ErrSSDViolation
+}
+
+// DSDSet 动态职责分离(Dynamic Separation of Duty)约束
+// 同时激活的角色(含继承角色)中，属于Roles的角色数量不得达到Cardinality
+type DSDSet struct {
+	CreatedAt   int64
+	Name        string
+	Roles       []Role
+	Cardinality int
+}
+
+// DSDViolationError 违反动态职责分离约束的详细信息，errors.Is(err, errs.ErrDSDViolation) 为true
+type DSDViolationError struct {
+	// 被违反的约束名
+	Set         string
+	Cardinality int
+	// 相互冲突的角色
+	Roles []Role
+}
+
+func (e *DSDViolationError) Error() string {
+	return fmt.Sprintf("dsd violation: set %s forbids activating %d or more of roles %v", e.Set, e.Cardinality, e.Roles)
+}
+
+func (e *DSDViolationError) Is(target error) bool {
+	return target == errs.ErrDSDViolation
+}
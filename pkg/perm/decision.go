@@ -0,0 +1,102 @@
+package perm
+
+import (
+	"fmt"
+
+	"github.com/gromitlee/access/pkg/errs"
+)
+
+// Reason 权限判定的原因
+type Reason uint8
+
+const (
+	// ReasonGranted 匹配到允许权限
+	ReasonGranted Reason = iota
+	// ReasonAdminBypass 内置admin角色，不检查权限
+	ReasonAdminBypass
+	// ReasonDenied 匹配到拒绝权限(拒绝优先)
+	ReasonDenied
+	// ReasonNoGrant 没有匹配的权限
+	ReasonNoGrant
+	// ReasonRoleDisabled 角色未启用
+	ReasonRoleDisabled
+	// ReasonRoleNotFound 角色不存在或在域中不可见
+	ReasonRoleNotFound
+)
+
+var reasonNames = map[Reason]string{
+	ReasonGranted:      "granted",
+	ReasonAdminBypass:  "admin_bypass",
+	ReasonDenied:       "denied",
+	ReasonNoGrant:      "no_grant",
+	ReasonRoleDisabled: "role_disabled",
+	ReasonRoleNotFound: "role_not_found",
+}
+
+func (r Reason) String() string {
+	if name, ok := reasonNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func (r Reason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Reason) UnmarshalText(text []byte) error {
+	for reason, name := range reasonNames {
+		if name == string(text) {
+			*r = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid reason %q", text)
+}
+
+// Decision 权限判定结果
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  Reason `json:"reason"`
+	// 做出判定的角色，多个角色都不可用时为第一个角色，没有角色时为0
+	Role Role `json:"role"`
+	// 匹配的权限(ReasonGranted / ReasonDenied)
+	Grant *Perm `json:"grant,omitempty"`
+	// 直接持有Grant的角色，通过继承获得权限时与Role不同
+	GrantRole Role `json:"grant_role,omitempty"`
+}
+
+// Err 判定为拒绝时返回对应的错误：errs.ErrRoleNotFound / errs.ErrRoleDisabled / errs.ErrPermissionDenied，允许时为nil
+func (d *Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	switch d.Reason {
+	case ReasonRoleNotFound:
+		return errs.ErrRoleNotFound
+	case ReasonRoleDisabled:
+		return errs.ErrRoleDisabled
+	default:
+		return errs.ErrPermissionDenied
+	}
+}
+
+// CombineDecisions 合并多个角色的判定结果，与 CheckPerms 语义一致：
+// 有启用的内置admin即允许；否则拒绝优先，其次允许；都不匹配时依次取 NoGrant / RoleDisabled / RoleNotFound 的第一个结果
+func CombineDecisions(ds []*Decision) *Decision {
+	for _, reason := range []Reason{
+		ReasonAdminBypass,
+		ReasonDenied,
+		ReasonGranted,
+		ReasonNoGrant,
+		ReasonRoleDisabled,
+		ReasonRoleNotFound,
+	} {
+		for _, d := range ds {
+			if d.Reason == reason {
+				return d
+			}
+		}
+	}
+	return &Decision{Reason: ReasonNoGrant}
+}
@@ -0,0 +1,25 @@
+package perm
+
+// Active 判断权限p在now(毫秒时间戳)时是否处于有效期内
+func (p Perm) Active(now int64) bool {
+	if p.NotBefore != 0 && now < p.NotBefore {
+		return false
+	}
+	return !p.Expired(now)
+}
+
+// Expired 判断权限p在now(毫秒时间戳)时是否已过期
+func (p Perm) Expired(now int64) bool {
+	return p.ExpiresAt != 0 && now >= p.ExpiresAt
+}
+
+// ExpiringPerms 返回直接授予的权限中，在now之后within毫秒内将过期(尚未过期)的权限
+func (rp *RolePerms) ExpiringPerms(now, within int64) []Perm {
+	var rets []Perm
+	for _, p := range rp.Perms {
+		if p.ExpiresAt != 0 && !p.Expired(now) && p.ExpiresAt <= now+within {
+			rets = append(rets, p)
+		}
+	}
+	return rets
+}
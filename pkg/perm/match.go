@@ -0,0 +1,26 @@
+package perm
+
+import "strings"
+
+// Wildcard 通配符，Obj与Act中第一个Wildcard匹配任意后缀
+const Wildcard = "*"
+
+// Match 判断权限p是否匹配obj与act
+// p.Obj与p.Act可以是模式，语义与casbin keyMatch一致：模式中第一个"*"匹配任意后缀，
+// 例如"project/*"匹配"project/1"与"project/1/doc"，"*"匹配一切
+// 多个权限同时匹配时不区分精确程度：任一拒绝(EffectDeny)权限匹配即无权限，否则任一允许权限匹配即有权限
+func (p Perm) Match(obj Obj, act Act) bool {
+	return keyMatch(string(obj), string(p.Obj)) && keyMatch(string(act), string(p.Act))
+}
+
+// keyMatch 判断key是否匹配pattern，与casbin util.KeyMatch一致
+func keyMatch(key, pattern string) bool {
+	i := strings.Index(pattern, Wildcard)
+	if i == -1 {
+		return key == pattern
+	}
+	if len(key) > i {
+		return key[:i] == pattern[:i]
+	}
+	return key == pattern[:i]
+}
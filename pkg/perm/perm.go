@@ -1,5 +1,21 @@
 package perm
 
+import (
+	"fmt"
+
+	"github.com/gromitlee/access/pkg/errs"
+)
+
+// Domain 域(租户)
+type Domain string
+
+const (
+	// GlobalDomain 全局域，属于全局域的角色与权限在所有域中生效
+	GlobalDomain Domain = ""
+	// reservedDomain 保留的域名，casbin实现在policy中以其表示全局域，不能用作租户域
+	reservedDomain Domain = "*"
+)
+
 // Role 角色
 type Role uint32
 
@@ -9,15 +25,35 @@ type Obj string
 // Act 角色对资源可进行对操作
 type Act string
 
+// Effect 权限效果
+type Effect uint8
+
+const (
+	// EffectAllow 允许(默认)
+	EffectAllow Effect = iota
+	// EffectDeny 拒绝，优先于允许
+	EffectDeny
+)
+
 // Perm 权限
 type Perm struct {
-	Obj Obj
-	Act Act
+	// 权限生效的域，域角色的权限只能属于角色所在的域
+	Domain Domain
+	Obj    Obj
+	Act    Act
+	Effect Effect
+	// 权限生效时间(毫秒时间戳)，为0表示立即生效
+	NotBefore int64
+	// 权限过期时间(毫秒时间戳)，为0表示永不过期
+	ExpiresAt int64
+	// 条件表达式(ABAC)，为空表示无条件，见 Perm.MatchCond
+	Cond string
 }
 
 // RolePerms 角色权限
 type RolePerms struct {
 	CreatedAt int64
+	Domain    Domain
 	Role      Role
 	Enable    bool
 	IsAdmin   bool
@@ -25,11 +61,14 @@ type RolePerms struct {
 	Name      string
 	Desc      string
 	Perms     []Perm
+	// 通过角色继承获得的权限
+	InheritedPerms []Perm
 }
 
 // RoleInfo 角色信息
 type RoleInfo struct {
 	CreatedAt int64
+	Domain    Domain
 	Role      Role
 	Enable    bool
 	IsAdmin   bool
@@ -37,3 +76,63 @@ type RoleInfo struct {
 	Name      string
 	Desc      string
 }
+
+// SessionInfo 会话信息
+type SessionInfo struct {
+	CreatedAt int64
+	Session   int64
+	Domain    Domain
+	User      int64
+	// 已激活的角色
+	Roles []Role
+}
+
+// Validate 校验d可以用作角色、权限与会话的域，不合法时返回 errs.ErrInvalidDomain
+// 空字符串即 GlobalDomain，不能用作租户域；"*"为保留的域名
+func (d Domain) Validate() error {
+	if d == reservedDomain {
+		return fmt.Errorf("%w: %q is reserved", errs.ErrInvalidDomain, d)
+	}
+	return nil
+}
+
+func (e Effect) String() string {
+	if e == EffectDeny {
+		return "deny"
+	}
+	return "allow"
+}
+
+func (e Effect) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *Effect) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "allow", "":
+		*e = EffectAllow
+	case "deny":
+		*e = EffectDeny
+	default:
+		return fmt.Errorf("invalid effect %q", text)
+	}
+	return nil
+}
+
+// String 权限的可读形式，例如 "allow obj/* read domain=tenant1 nbf=0 exp=1700000000000 cond=amount < 100"
+func (p Perm) String() string {
+	s := fmt.Sprintf("%s %s %s", p.Effect, p.Obj, p.Act)
+	if p.Domain != GlobalDomain {
+		s += fmt.Sprintf(" domain=%s", p.Domain)
+	}
+	if p.NotBefore != 0 {
+		s += fmt.Sprintf(" nbf=%d", p.NotBefore)
+	}
+	if p.ExpiresAt != 0 {
+		s += fmt.Sprintf(" exp=%d", p.ExpiresAt)
+	}
+	if p.Cond != "" {
+		s += fmt.Sprintf(" cond=%s", p.Cond)
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package perm
+
+import (
+	"fmt"
+
+	"github.com/gromitlee/access/pkg/errs"
+)
+
+// RoleSortField 角色列表的排序字段
+type RoleSortField string
+
+const (
+	RoleSortID        RoleSortField = "id"
+	RoleSortCreatedAt RoleSortField = "created_at"
+	RoleSortUpdatedAt RoleSortField = "updated_at"
+	RoleSortDomain    RoleSortField = "domain"
+	RoleSortEnable    RoleSortField = "enable"
+	RoleSortIsAdmin   RoleSortField = "is_admin"
+	RoleSortCreator   RoleSortField = "creator"
+	RoleSortName      RoleSortField = "name"
+)
+
+var roleSortFields = map[RoleSortField]bool{
+	RoleSortID:        true,
+	RoleSortCreatedAt: true,
+	RoleSortUpdatedAt: true,
+	RoleSortDomain:    true,
+	RoleSortEnable:    true,
+	RoleSortIsAdmin:   true,
+	RoleSortCreator:   true,
+	RoleSortName:      true,
+}
+
+// RoleQuery 角色列表的查询条件，零值字段不参与过滤，多个条件同时满足
+type RoleQuery struct {
+	// 仅查询在Domain中生效的角色(全局角色与Domain的角色)，为空时不按域过滤
+	Domain Domain
+	// 角色集合
+	Roles []Role
+	// 角色名精确匹配
+	Name string
+	// 角色名包含NameLike
+	NameLike string
+	// 启用状态与admin标记，为nil时不过滤
+	Enable  *bool
+	IsAdmin *bool
+	// 创建用户
+	Creator int64
+	// 创建时间范围(毫秒时间戳)：[CreatedSince, CreatedUntil)
+	CreatedSince int64
+	CreatedUntil int64
+	// 直接授予了Obj/Act允许权限的角色(不含继承)，Act为空时匹配Obj的任意操作
+	// 按授予时的字面值匹配，不展开通配符；Domain非空时仅匹配在Domain中生效的权限
+	Obj Obj
+	Act Act
+	// 排序字段，为空时按id；相同时按id，方向与Desc一致
+	SortBy RoleSortField
+	Desc   bool
+	// 分页，Limit为0表示不分页
+	Offset int64
+	Limit  int64
+	// 游标分页(见 IRBAC0Controller.PageRoleInfo)：上一页返回的 Page.Next，为空时从第一页开始，不能与Offset同时使用
+	// 排序条件(SortBy/Desc)须与上一页一致
+	Cursor string
+	// 游标分页时是否查询总数，需要额外的Count查询
+	WithCount bool
+}
+
+// Page 游标分页查询的一页结果
+type Page[T any] struct {
+	Items []T
+	// 下一页的游标，为空表示没有下一页
+	Next string
+	// 满足条件的总数，未要求查询总数时为-1
+	Count int64
+}
+
+// Validate 校验查询条件，分页参数不合法时返回 errs.ErrInvalidPagination，其他条件不合法时返回 errs.ErrInvalidQuery
+func (q *RoleQuery) Validate() error {
+	if q.Offset < 0 || q.Limit < 0 || (q.Cursor != "" && q.Offset != 0) {
+		return errs.ErrInvalidPagination
+	}
+	if q.SortBy != "" && !roleSortFields[q.SortBy] {
+		return fmt.Errorf("%w: sort by %q", errs.ErrInvalidQuery, q.SortBy)
+	}
+	if q.CreatedSince != 0 && q.CreatedUntil != 0 && q.CreatedSince >= q.CreatedUntil {
+		return fmt.Errorf("%w: created range", errs.ErrInvalidQuery)
+	}
+	if q.Obj == "" && q.Act != "" {
+		return fmt.Errorf("%w: act without obj", errs.ErrInvalidQuery)
+	}
+	return nil
+}
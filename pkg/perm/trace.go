@@ -0,0 +1,109 @@
+package perm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TraceStepKind 权限检查步骤类型
+type TraceStepKind string
+
+const (
+	// TraceStepRole 查询角色及其启用、admin状态
+	TraceStepRole TraceStepKind = "role"
+	// TraceStepInherit 展开角色继承关系
+	TraceStepInherit TraceStepKind = "inherit"
+	// TraceStepDSD 检查动态职责分离约束
+	TraceStepDSD TraceStepKind = "dsd"
+	// TraceStepGrant 评估候选权限
+	TraceStepGrant TraceStepKind = "grant"
+	// TraceStepDecision 得出判定结果
+	TraceStepDecision TraceStepKind = "decision"
+)
+
+// TraceStep 权限检查步骤
+type TraceStep struct {
+	Kind TraceStepKind `json:"kind"`
+	// 步骤所属的角色
+	Role Role `json:"role,omitempty"`
+	// 被评估的权限(TraceStepGrant)
+	Grant *Perm `json:"grant,omitempty"`
+	// 直接持有Grant的角色
+	GrantRole Role `json:"grant_role,omitempty"`
+	// 权限是否参与判定(TraceStepGrant)
+	Matched bool   `json:"matched,omitempty"`
+	Message string `json:"message"`
+}
+
+// Trace 权限检查过程，见 IRBAC0Controller.Explain
+type Trace struct {
+	Domain   Domain      `json:"domain"`
+	Roles    []Role      `json:"roles"`
+	Obj      Obj         `json:"obj"`
+	Act      Act         `json:"act"`
+	Steps    []TraceStep `json:"steps"`
+	Decision *Decision   `json:"decision,omitempty"`
+}
+
+// AddStep 记录一个步骤，t为nil时不记录
+func (t *Trace) AddStep(kind TraceStepKind, role Role, format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.Steps = append(t.Steps, TraceStep{
+		Kind:    kind,
+		Role:    role,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// AddGrant 记录role对候选权限p(由grantRole直接持有)的评估，t为nil时不记录
+func (t *Trace) AddGrant(role, grantRole Role, p Perm, now int64, attrs map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	var message string
+	matched := p.Applies(t.Obj, t.Act, now, attrs)
+	if !p.Match(t.Obj, t.Act) {
+		message = "obj/act not matched"
+	} else if !p.Active(now) {
+		message = "outside validity window"
+	} else if ok, err := p.MatchCond(attrs); err != nil {
+		message = fmt.Sprintf("cond error: %v", err)
+	} else if !ok {
+		message = "cond not satisfied"
+	} else {
+		message = "matched"
+	}
+	t.Steps = append(t.Steps, TraceStep{
+		Kind:      TraceStepGrant,
+		Role:      role,
+		Grant:     &p,
+		GrantRole: grantRole,
+		Matched:   matched,
+		Message:   message,
+	})
+}
+
+// String 以文本形式展示检查过程
+func (t *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "explain domain=%q roles=%v obj=%q act=%q\n", t.Domain, t.Roles, t.Obj, t.Act)
+	for i, step := range t.Steps {
+		fmt.Fprintf(&b, "%d. [%s]", i+1, step.Kind)
+		if step.Role != 0 {
+			fmt.Fprintf(&b, " role=%d", step.Role)
+		}
+		if step.Grant != nil {
+			fmt.Fprintf(&b, " grant_role=%d grant={%s}", step.GrantRole, step.Grant)
+		}
+		fmt.Fprintf(&b, " %s\n", step.Message)
+	}
+	return b.String()
+}
+
+// JSON 以JSON形式展示检查过程
+func (t *Trace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gromitlee/access/pkg/perm"
+)
+
+// PlanOptions 生成 Plan 的选项
+type PlanOptions struct {
+	// Protect 不删除期望策略中没有的角色，即只修改由策略文件管理的角色
+	Protect bool
+	// Merge 不撤销期望策略中没有的权限(同时设置Protect即为 ImportMerge)
+	Merge bool
+}
+
+// Plan 使当前策略与期望策略一致所需的修改，按Create、Update、Delete的顺序执行
+type Plan struct {
+	// 新建的角色及其权限
+	Create []*Role
+	// 已有角色的修改
+	Update []*RoleChange
+	// 删除的角色(删除前的角色与权限)
+	Delete []*Role
+}
+
+// RoleChange 已有角色的修改
+type RoleChange struct {
+	ID perm.Role
+	// 修改前后的角色
+	From *Role
+	To   *Role
+	// 更新角色名与描述
+	UpdateInfo bool
+	// 启用或停用角色
+	UpdateEnable bool
+	// 授予的权限，包括有效期变化的权限
+	Grant []perm.Perm
+	// 撤销的权限
+	Revoke []perm.Perm
+}
+
+// Diff 比较当前策略live与期望策略desired，生成 Plan
+// 已有角色的域与admin标记不一致时返回错误：这两项只能通过删除后重新创建角色修改
+func Diff(live, desired *Policy, opts PlanOptions) (*Plan, error) {
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+	liveRoles := make(map[perm.Role]*Role, len(live.Roles))
+	for _, r := range live.Roles {
+		liveRoles[r.ID] = r
+	}
+	plan := &Plan{}
+	wanted := make(map[perm.Role]bool, len(desired.Roles))
+	for _, r := range desired.Roles {
+		wanted[r.ID] = true
+		cur := liveRoles[r.ID]
+		if cur == nil {
+			plan.Create = append(plan.Create, r)
+			continue
+		}
+		if cur.Domain != r.Domain || cur.IsAdmin != r.IsAdmin {
+			return nil, fmt.Errorf("policy: role %d: domain and admin flag cannot be changed", r.ID)
+		}
+		c := &RoleChange{
+			ID:           r.ID,
+			From:         cur,
+			To:           r,
+			UpdateInfo:   cur.Name != r.Name || cur.Desc != r.Desc,
+			UpdateEnable: cur.Enable != r.Enable,
+		}
+		if !r.IsAdmin {
+			if !opts.Merge {
+				c.Revoke = missingPerms(cur.PermList(), r.PermList(), false)
+			}
+			c.Grant = missingPerms(r.PermList(), cur.PermList(), true)
+		}
+		if c.UpdateInfo || c.UpdateEnable || len(c.Grant) > 0 || len(c.Revoke) > 0 {
+			plan.Update = append(plan.Update, c)
+		}
+	}
+	if !opts.Protect {
+		for _, r := range live.Roles {
+			if !wanted[r.ID] {
+				plan.Delete = append(plan.Delete, r)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// Empty 当前策略已与期望策略一致
+func (p *Plan) Empty() bool {
+	return len(p.Create) == 0 && len(p.Update) == 0 && len(p.Delete) == 0
+}
+
+// String 可读的修改内容，每个角色一行："+"为创建、"~"为修改、"-"为删除，其下缩进列出授予("+")与撤销("-")的权限
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, r := range p.Create {
+		fmt.Fprintf(&b, "+ role %d %q%s\n", r.ID, r.Name, roleAttrs(r))
+		if !r.IsAdmin {
+			for _, pm := range r.PermList() {
+				fmt.Fprintf(&b, "    + %s\n", pm)
+			}
+		}
+	}
+	for _, c := range p.Update {
+		fmt.Fprintf(&b, "~ role %d %q\n", c.ID, c.To.Name)
+		if c.UpdateInfo {
+			if c.From.Name != c.To.Name {
+				fmt.Fprintf(&b, "    name: %q -> %q\n", c.From.Name, c.To.Name)
+			}
+			if c.From.Desc != c.To.Desc {
+				fmt.Fprintf(&b, "    desc: %q -> %q\n", c.From.Desc, c.To.Desc)
+			}
+		}
+		if c.UpdateEnable {
+			fmt.Fprintf(&b, "    enable: %v -> %v\n", c.From.Enable, c.To.Enable)
+		}
+		for _, pm := range c.Revoke {
+			fmt.Fprintf(&b, "    - %s\n", pm)
+		}
+		for _, pm := range c.Grant {
+			fmt.Fprintf(&b, "    + %s\n", pm)
+		}
+	}
+	for _, r := range p.Delete {
+		fmt.Fprintf(&b, "- role %d %q\n", r.ID, r.Name)
+	}
+	return b.String()
+}
+
+// --- internal function ---
+
+func roleAttrs(r *Role) string {
+	var s string
+	if r.Domain != perm.GlobalDomain {
+		s += fmt.Sprintf(" domain=%s", r.Domain)
+	}
+	if r.IsAdmin {
+		s += " admin"
+	}
+	if !r.Enable {
+		s += " disabled"
+	}
+	return s
+}
+
+// missingPerms perms中不在others中的权限，withExpiry为false时不区分有效期(与撤销权限一致)
+func missingPerms(perms, others []perm.Perm, withExpiry bool) []perm.Perm {
+	var rets []perm.Perm
+	for _, p := range perms {
+		var exist bool
+		for _, o := range others {
+			if !withExpiry {
+				o.NotBefore, o.ExpiresAt = p.NotBefore, p.ExpiresAt
+			}
+			if o == p {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			rets = append(rets, p)
+		}
+	}
+	return rets
+}
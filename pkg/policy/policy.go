@@ -0,0 +1,189 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gromitlee/access/pkg/perm"
+	"gopkg.in/yaml.v3"
+)
+
+// Format 策略文件格式
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ErrEmptyPolicy 策略文件为空，或以 ImportReplace 导入不含角色的策略
+// 避免被截断或路径错误的文件删除全部角色；确需删除全部角色时通过 Diff 生成 Plan 后执行
+var ErrEmptyPolicy = errors.New("policy: empty document")
+
+// ImportMode 导入策略文件的方式，对应的 PlanOptions 见 ImportMode.PlanOptions
+type ImportMode uint8
+
+const (
+	// ImportMerge 创建文件中新增的角色，按文件更新已有角色的信息并授予文件中的权限，不删除角色与权限
+	ImportMerge ImportMode = iota
+	// ImportReplace 使角色与权限和文件一致：删除文件中没有的角色，撤销文件中没有的权限
+	// 文件中没有角色时返回 ErrEmptyPolicy，不删除任何角色
+	ImportReplace
+)
+
+// PlanOptions 导入方式对应的 PlanOptions
+func (m ImportMode) PlanOptions() PlanOptions {
+	if m == ImportMerge {
+		return PlanOptions{Protect: true, Merge: true}
+	}
+	return PlanOptions{}
+}
+
+// Policy 声明式的角色与权限，可编码为YAML或JSON文件
+// 仅包括角色信息与直接授予的权限，不包括角色继承、用户角色分配、会话与职责分离约束
+type Policy struct {
+	Roles []*Role `json:"roles" yaml:"roles"`
+}
+
+// Role 角色及其直接授予的权限
+type Role struct {
+	// 角色枚举值，不能为0
+	ID     perm.Role   `json:"id" yaml:"id"`
+	Domain perm.Domain `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Name   string      `json:"name" yaml:"name"`
+	Desc   string      `json:"desc,omitempty" yaml:"desc,omitempty"`
+	// 是否启用，文件中省略时为true
+	Enable  bool `json:"enable" yaml:"enable"`
+	IsAdmin bool `json:"is_admin,omitempty" yaml:"is_admin,omitempty"`
+	// 内置admin的权限被忽略
+	Perms []Perm `json:"perms,omitempty" yaml:"perms,omitempty"`
+}
+
+// Perm 权限，字段含义见 perm.Perm
+type Perm struct {
+	Domain    perm.Domain `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Obj       perm.Obj    `json:"obj" yaml:"obj"`
+	Act       perm.Act    `json:"act" yaml:"act"`
+	Effect    perm.Effect `json:"effect,omitempty" yaml:"effect,omitempty"`
+	NotBefore int64       `json:"not_before,omitempty" yaml:"not_before,omitempty"`
+	ExpiresAt int64       `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	Cond      string      `json:"cond,omitempty" yaml:"cond,omitempty"`
+}
+
+// FromRolePerms 由角色权限(例如 IRBAC0Controller.QueryRolePerms 的结果)生成Policy，不包括继承获得的权限
+func FromRolePerms(rolePerms []*perm.RolePerms) *Policy {
+	p := &Policy{Roles: []*Role{}}
+	for _, rp := range rolePerms {
+		r := &Role{
+			ID:      rp.Role,
+			Domain:  rp.Domain,
+			Name:    rp.Name,
+			Desc:    rp.Desc,
+			Enable:  rp.Enable,
+			IsAdmin: rp.IsAdmin,
+		}
+		for _, pm := range rp.Perms {
+			r.Perms = append(r.Perms, Perm(pm))
+		}
+		p.Roles = append(p.Roles, r)
+	}
+	return p
+}
+
+// Encode 按format将p写入w
+func Encode(w io.Writer, p *Policy, format Format) error {
+	switch format {
+	case FormatYAML:
+		e := yaml.NewEncoder(w)
+		e.SetIndent(2)
+		if err := e.Encode(p); err != nil {
+			return err
+		}
+		return e.Close()
+	case FormatJSON:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		e.SetEscapeHTML(false)
+		return e.Encode(p)
+	default:
+		return fmt.Errorf("invalid policy format %q", format)
+	}
+}
+
+// Decode 按format从r读取Policy并校验，见 Policy.Validate；r中没有内容时返回 ErrEmptyPolicy
+func Decode(r io.Reader, format Format) (*Policy, error) {
+	p := &Policy{}
+	var err error
+	switch format {
+	case FormatYAML:
+		err = yaml.NewDecoder(r).Decode(p)
+	case FormatJSON:
+		err = json.NewDecoder(r).Decode(p)
+	default:
+		return nil, fmt.Errorf("invalid policy format %q", format)
+	}
+	if err == io.EOF {
+		return nil, ErrEmptyPolicy
+	} else if err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate 校验角色枚举值非0且不重复，权限的条件表达式可以解析
+func (p *Policy) Validate() error {
+	exist := make(map[perm.Role]bool, len(p.Roles))
+	for _, r := range p.Roles {
+		if r == nil || r.ID == 0 {
+			return fmt.Errorf("policy: role id required")
+		}
+		if exist[r.ID] {
+			return fmt.Errorf("policy: duplicate role %d", r.ID)
+		}
+		exist[r.ID] = true
+		for _, pm := range r.PermList() {
+			if err := pm.ValidateCond(); err != nil {
+				return fmt.Errorf("policy: role %d: %w", r.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// PermList 角色的权限，域角色未指定域的权限归属角色所在的域(与 IRBAC0Controller.GrantRolePerms 一致)
+func (r *Role) PermList() []perm.Perm {
+	var rets []perm.Perm
+	for _, p := range r.Perms {
+		pm := perm.Perm(p)
+		if pm.Domain == perm.GlobalDomain {
+			pm.Domain = r.Domain
+		}
+		rets = append(rets, pm)
+	}
+	return rets
+}
+
+func (r *Role) UnmarshalJSON(data []byte) error {
+	type role Role
+	v := role{Enable: true}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Role(v)
+	return nil
+}
+
+func (r *Role) UnmarshalYAML(value *yaml.Node) error {
+	type role Role
+	v := role{Enable: true}
+	if err := value.Decode(&v); err != nil {
+		return err
+	}
+	*r = Role(v)
+	return nil
+}
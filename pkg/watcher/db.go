@@ -0,0 +1,131 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/gromitlee/access/internal/db/model"
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBWatcher 基于数据库轮询的 Watcher，适用于任意gorm支持的数据库
+// 每个发生变更的角色在变更版本表中有一行，Publish 递增版本，各实例周期性比较版本得到变更的角色
+type DBWatcher struct {
+	subscribers
+
+	db       *gorm.DB
+	interval time.Duration
+	versions map[perm.Role]int64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDBWatcher 创建数据库轮询 Watcher，每隔interval查询一次变更版本表
+// 订阅方最迟在interval后收到其他实例的变更
+func NewDBWatcher(db *gorm.DB, interval time.Duration) (*DBWatcher, error) {
+	if err := db.AutoMigrate(model.ChangeVersion{}); err != nil {
+		return nil, err
+	}
+	w := &DBWatcher{
+		db:       db,
+		interval: interval,
+		versions: make(map[perm.Role]int64),
+		done:     make(chan struct{}),
+	}
+	// 以当前版本为基线，之前的变更不再通知
+	if _, err := w.poll(db); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	go w.run(ctx)
+	return w, nil
+}
+
+func (w *DBWatcher) Publish(db *gorm.DB, ev Event) error {
+	roles := ev.Roles
+	if ev.All() {
+		roles = []perm.Role{0}
+	}
+	var dbVersions []*model.ChangeVersion
+	for _, role := range uniqueRoles(roles) {
+		dbVersions = append(dbVersions, &model.ChangeVersion{Role: role, Version: 1})
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"version": gorm.Expr("version + 1")}),
+	}).Create(dbVersions).Error
+}
+
+func (w *DBWatcher) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// --- internal method ---
+
+func (w *DBWatcher) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ev, err := w.poll(w.db.WithContext(ctx))
+			if err != nil {
+				// 下次轮询重试
+				continue
+			}
+			if ev != nil {
+				w.notify(*ev)
+			}
+		}
+	}
+}
+
+// poll 查询变更版本表，返回自上次查询以来的变更，无变更时返回nil
+func (w *DBWatcher) poll(db *gorm.DB) (*Event, error) {
+	var dbVersions []*model.ChangeVersion
+	if err := db.Find(&dbVersions).Error; err != nil {
+		return nil, err
+	}
+	var roles []perm.Role
+	var all bool
+	for _, v := range dbVersions {
+		if w.versions[v.Role] != v.Version {
+			w.versions[v.Role] = v.Version
+			if v.Role == 0 {
+				all = true
+			} else {
+				roles = append(roles, v.Role)
+			}
+		}
+	}
+	if all {
+		return &Event{}, nil
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	return &Event{Roles: roles}, nil
+}
+
+// --- internal function ---
+
+func uniqueRoles(roles []perm.Role) []perm.Role {
+	var rets []perm.Role
+	exist := make(map[perm.Role]bool, len(roles))
+	for _, role := range roles {
+		if !exist[role] {
+			exist[role] = true
+			rets = append(rets, role)
+		}
+	}
+	return rets
+}
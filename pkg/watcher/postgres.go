@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// 连接断开后重新LISTEN的间隔
+const postgresReconnectInterval = time.Second
+
+// PostgresWatcher 基于PostgreSQL LISTEN/NOTIFY的 Watcher，变更实时送达
+// 须使用基于pgx的gorm postgres驱动(gorm.io/driver/postgres)，LISTEN会独占连接池中的一个连接
+type PostgresWatcher struct {
+	subscribers
+
+	db      *gorm.DB
+	channel string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPostgresWatcher 创建PostgreSQL LISTEN/NOTIFY Watcher，各实例须使用相同的channel
+func NewPostgresWatcher(db *gorm.DB, channel string) (*PostgresWatcher, error) {
+	w := &PostgresWatcher{
+		db:      db,
+		channel: channel,
+		done:    make(chan struct{}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	listening := make(chan error, 1)
+	go w.run(ctx, listening)
+	if err := <-listening; err != nil {
+		cancel()
+		<-w.done
+		return nil, err
+	}
+	w.cancel = cancel
+	return w, nil
+}
+
+func (w *PostgresWatcher) Publish(db *gorm.DB, ev Event) error {
+	payload, err := json.Marshal(&ev)
+	if err != nil {
+		return err
+	}
+	// NOTIFY在事务提交后才会送达
+	return db.Exec("SELECT pg_notify(?, ?)", w.channel, string(payload)).Error
+}
+
+func (w *PostgresWatcher) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+// --- internal method ---
+
+// run 持续LISTEN，首次LISTEN的结果写入listening，首次LISTEN失败时退出；
+// 之后断开均重连，并在重连后通知全部角色变更以弥补断开期间丢失的通知
+func (w *PostgresWatcher) run(ctx context.Context, listening chan<- error) {
+	defer close(w.done)
+	// 首次LISTEN是否已成功
+	listened := false
+	for {
+		err := w.listen(ctx, func() {
+			if !listened {
+				listened = true
+				listening <- nil
+			} else {
+				w.notify(Event{})
+			}
+		})
+		if !listened {
+			listening <- err
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(postgresReconnectInterval):
+		}
+	}
+}
+
+// listen 在独占的连接上LISTEN并分发通知，直到出错或ctx结束；LISTEN成功后调用onListen
+func (w *PostgresWatcher) listen(ctx context.Context, onListen func()) error {
+	sqlDB, err := w.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("postgres watcher requires pgx driver")
+		}
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+pgx.Identifier{w.channel}.Sanitize()); err != nil {
+			return err
+		}
+		onListen()
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+				ev = Event{}
+			}
+			w.notify(ev)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"sync"
+
+	"github.com/gromitlee/access/pkg/perm"
+	"gorm.io/gorm"
+)
+
+// Event 变更事件
+type Event struct {
+	// 发生变更的角色(订阅方应同时失效继承了这些角色的角色)，为空表示全部角色
+	Roles []perm.Role `json:"roles,omitempty"`
+}
+
+// All 是否为全部角色的变更
+func (ev Event) All() bool {
+	return len(ev.Roles) == 0
+}
+
+// Watcher 跨实例的变更通知
+// 控制器在修改角色与权限的事务中调用 Publish，缓存与casbin enforcer通过 Subscribe 接收所有实例(含本实例)的变更
+type Watcher interface {
+	// Publish 在db中发布变更，db为事务时变更在事务提交后才会被订阅方收到
+	Publish(db *gorm.DB, ev Event) error
+	// Subscribe 注册变更回调，回调在Watcher的goroutine中串行执行，不应阻塞；返回的函数用于取消订阅
+	Subscribe(fn func(Event)) (unsubscribe func())
+	// Close 停止接收变更
+	Close() error
+}
+
+// subscribers 回调列表，供各实现复用
+type subscribers struct {
+	mu   sync.RWMutex
+	subs []*subscription
+}
+
+type subscription struct {
+	fn func(Event)
+}
+
+func (s *subscribers) Subscribe(fn func(Event)) func() {
+	sub := &subscription{fn: fn}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, sub)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// 复制后删除，不影响正在通知的回调列表
+		subs := make([]*subscription, 0, len(s.subs))
+		for _, _sub := range s.subs {
+			if _sub != sub {
+				subs = append(subs, _sub)
+			}
+		}
+		s.subs = subs
+	}
+}
+
+func (s *subscribers) notify(ev Event) {
+	s.mu.RLock()
+	subs := s.subs
+	s.mu.RUnlock()
+	for _, sub := range subs {
+		sub.fn(ev)
+	}
+}
@@ -1,9 +1,16 @@
 package access
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/decisionlog"
+	"github.com/gromitlee/access/pkg/errs"
 	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
 	"gorm.io/gorm"
 )
 
@@ -12,123 +19,446 @@ var _rbac0Ctl IRBAC0Controller
 
 func InitCasbinRBAC0Controller(db *gorm.DB, modelPath string) error {
 	if _rbac0Ctl != nil {
-		return errors.New("rbac0 ctl already init")
+		return errs.ErrAlreadyInitialized
 	}
 	var err error
 	_rbac0Ctl, err = NewCasbinRBAC0Controller(db, modelPath)
 	return err
 }
 
+// InitCasbinRBAC0ControllerWithModel 见 NewCasbinRBAC0ControllerWithModel
+func InitCasbinRBAC0ControllerWithModel(db *gorm.DB, m model.Model) error {
+	if _rbac0Ctl != nil {
+		return errs.ErrAlreadyInitialized
+	}
+	var err error
+	_rbac0Ctl, err = NewCasbinRBAC0ControllerWithModel(db, m)
+	return err
+}
+
 func InitAccessRBAC0Controller(db *gorm.DB) error {
 	if _rbac0Ctl != nil {
-		return errors.New("rbac0 ctl already init")
+		return errs.ErrAlreadyInitialized
 	}
 	var err error
 	_rbac0Ctl, err = NewAccessRBAC0Controller(db)
 	return err
 }
 
-func RBAC0CheckPerm(db *gorm.DB, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+// SetRBAC0Controller 将单例替换为ctl(可为nil)，返回原单例，原单例由调用方关闭
+// 应在没有其他goroutine使用单例时调用，例如测试中替换为mock
+func SetRBAC0Controller(ctl IRBAC0Controller) IRBAC0Controller {
+	old := _rbac0Ctl
+	_rbac0Ctl = ctl
+	return old
+}
+
+// ResetRBAC0Controller 关闭并清空单例，之后可重新初始化；单例未初始化时不做任何事
+// 应在没有其他goroutine使用单例时调用，例如测试结束或服务优雅退出时
+func ResetRBAC0Controller(ctx context.Context) error {
+	if _rbac0Ctl == nil {
+		return nil
+	}
+	if err := _rbac0Ctl.Close(ctx); err != nil {
+		return err
+	}
+	_rbac0Ctl = nil
+	return nil
+}
+
+// RBAC0Health 检查单例是否可用(见 IRBAC0Controller.Health)
+func RBAC0Health(ctx context.Context) error {
 	if _rbac0Ctl == nil {
-		return false, false, false, errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
-	return _rbac0Ctl.CheckPermTx(db, role, obj, act)
+	return _rbac0Ctl.Health(ctx)
 }
 
-func RBAC0CheckPerms(db *gorm.DB, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+// EnableRBAC0Cache 为单例添加进程内缓存(见 CachedRBAC0Controller)，返回的控制器可用于查询统计与手动失效
+// 单例使用自定义casbin matcher或policy effect时返回错误，此时缓存与单例的判定不一致
+func EnableRBAC0Cache() (*CachedRBAC0Controller, error) {
 	if _rbac0Ctl == nil {
-		return false, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
+	}
+	if cached, ok := _rbac0Ctl.(*CachedRBAC0Controller); ok {
+		return cached, nil
 	}
-	return _rbac0Ctl.CheckPermsTx(db, roles, obj, act)
+	if _, ok := _rbac0Ctl.(*LoggedRBAC0Controller); ok {
+		// 缓存须位于判定日志之内，否则命中缓存的检查不会被记录
+		return nil, errors.New("rbac0 decision log enabled, enable cache first")
+	}
+	if !builtinMatcher(_rbac0Ctl) {
+		// 缓存在本地求值，与自定义matcher的判定不一致
+		return nil, fmt.Errorf("%w: rbac0 cache with custom casbin matcher", errs.ErrNotSupported)
+	}
+	cached := NewCachedRBAC0Controller(_rbac0Ctl)
+	_rbac0Ctl = cached
+	return cached, nil
 }
 
-func RBAC0CreateRole(db *gorm.DB, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+// EnableRBAC0DecisionLog 为单例添加判定日志(见 LoggedRBAC0Controller)，同时使用缓存时须先调用 EnableRBAC0Cache
+func EnableRBAC0DecisionLog(l *decisionlog.Logger) (*LoggedRBAC0Controller, error) {
 	if _rbac0Ctl == nil {
-		return nil, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
+	}
+	if _, ok := _rbac0Ctl.(*LoggedRBAC0Controller); ok {
+		return nil, fmt.Errorf("%w: rbac0 decision log", errs.ErrAlreadyInitialized)
 	}
-	return _rbac0Ctl.CreateRoleTx(db, role, creator, name, desc, isAdmin, perms...)
+	logged := NewLoggedRBAC0Controller(_rbac0Ctl, l)
+	_rbac0Ctl = logged
+	return logged, nil
+}
+
+// RBAC0SetWatcher 为单例设置跨实例变更通知(见 IRBAC0Controller.SetWatcher)
+func RBAC0SetWatcher(w watcher.Watcher) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	_rbac0Ctl.SetWatcher(w)
+	return nil
+}
+
+// RBAC0AddMatcherFunction 为单例注册matcher函数(见 IRBAC0Controller.AddMatcherFunction)
+func RBAC0AddMatcherFunction(name string, fn func(args ...interface{}) (interface{}, error)) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.AddMatcherFunction(name, fn)
+}
+
+// RBAC0Transaction 在同一事务中执行fn(见 IRBAC0Controller.Transaction)，fn中应将tx传给各RBAC0方法
+func RBAC0Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.TransactionTx(db, fn)
+}
+
+func RBAC0CheckPerm(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	if _rbac0Ctl == nil {
+		return false, false, false, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CheckPermTx(db, domain, role, obj, act)
+}
+
+func RBAC0CheckPermWithAttrs(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	if _rbac0Ctl == nil {
+		return false, false, false, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CheckPermWithAttrsTx(db, domain, role, obj, act, attrs)
+}
+
+func RBAC0CheckPerms(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	if _rbac0Ctl == nil {
+		return false, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CheckPermsTx(db, domain, roles, obj, act)
+}
+
+func RBAC0Decide(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DecideTx(db, domain, role, obj, act)
+}
+
+func RBAC0DecideMany(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DecideManyTx(db, domain, roles, obj, act)
+}
+
+func RBAC0Explain(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ExplainTx(db, domain, roles, obj, act)
+}
+
+func RBAC0CreateRole(db *gorm.DB, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CreateRoleTx(db, domain, role, creator, name, desc, isAdmin, perms...)
 }
 
 func RBAC0UpdateRole(db *gorm.DB, role perm.Role, name, desc string) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.UpdateRoleTx(db, role, name, desc)
 }
 
 func RBAC0DeleteRole(db *gorm.DB, role perm.Role) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.DeleteRoleTx(db, role)
 }
 
-func RBAC0ListRoleInfo(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
+func RBAC0ListRoleInfo(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error) {
+	if _rbac0Ctl == nil {
+		return nil, 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListRoleInfoTx(db, domain, name, enable, offset, limit, order)
+}
+
+func RBAC0QueryRoleInfo(db *gorm.DB, q perm.RoleQuery) ([]*perm.RoleInfo, int64, error) {
+	if _rbac0Ctl == nil {
+		return nil, 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.QueryRoleInfoTx(db, q)
+}
+
+func RBAC0PageRoleInfo(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RoleInfo], error) {
 	if _rbac0Ctl == nil {
-		return nil, 0, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
 	}
-	return _rbac0Ctl.ListRoleInfoTx(db, name, enable, offset, limit, order)
+	return _rbac0Ctl.PageRoleInfoTx(db, q)
 }
 
 func RBAC0GetRoleInfo(db *gorm.DB, role perm.Role) (*perm.RoleInfo, error) {
 	if _rbac0Ctl == nil {
-		return nil, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.GetRoleInfoTx(db, role)
 }
 
 func RBAC0GetRoleInfos(db *gorm.DB, roles []perm.Role, order int64) ([]*perm.RoleInfo, error) {
 	if _rbac0Ctl == nil {
-		return nil, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.GetRoleInfosTx(db, roles, order)
 }
 
-func RBAC0ListRolePerms(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
+func RBAC0ListRolePerms(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error) {
+	if _rbac0Ctl == nil {
+		return nil, 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListRolePermsTx(db, domain, name, enable, offset, limit, order)
+}
+
+func RBAC0QueryRolePerms(db *gorm.DB, q perm.RoleQuery) ([]*perm.RolePerms, int64, error) {
 	if _rbac0Ctl == nil {
-		return nil, 0, errors.New("rbac0 ctl not init")
+		return nil, 0, errs.ErrNotInitialized
 	}
-	return _rbac0Ctl.ListRolePermsTx(db, name, enable, offset, limit, order)
+	return _rbac0Ctl.QueryRolePermsTx(db, q)
+}
+
+func RBAC0PageRolePerms(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RolePerms], error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.PageRolePermsTx(db, q)
 }
 
 func RBAC0GetRolePerms(db *gorm.DB, role perm.Role) (*perm.RolePerms, error) {
 	if _rbac0Ctl == nil {
-		return nil, errors.New("rbac0 ctl not init")
+		return nil, errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.GetRolePermsTx(db, role)
 }
 
 func RBAC0GrantRolePerms(db *gorm.DB, role perm.Role, perms []perm.Perm) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.GrantRolePermsTx(db, role, perms)
 }
 
 func RBAC0RevokeRolePerms(db *gorm.DB, role perm.Role, perms []perm.Perm) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.RevokeRolePermsTx(db, role, perms)
 }
 
 func RBAC0CleanRolePerms(db *gorm.DB, role perm.Role) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.CleanRolePermsTx(db, role)
 }
 
+func RBAC0SweepExpiredPerms(db *gorm.DB) (int64, error) {
+	if _rbac0Ctl == nil {
+		return 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.SweepExpiredPermsTx(db)
+}
+
 func RBAC0EnableRole(db *gorm.DB, role perm.Role) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.EnableRoleTx(db, role)
 }
 
 func RBAC0DisableRole(db *gorm.DB, role perm.Role) error {
 	if _rbac0Ctl == nil {
-		return errors.New("rbac0 ctl not init")
+		return errs.ErrNotInitialized
 	}
 	return _rbac0Ctl.DisableRoleTx(db, role)
 }
+
+func RBAC0AssignUserRoles(db *gorm.DB, user int64, roles []perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.AssignUserRolesTx(db, user, roles)
+}
+
+func RBAC0DeassignUserRoles(db *gorm.DB, user int64, roles []perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DeassignUserRolesTx(db, user, roles)
+}
+
+func RBAC0ListUserRoles(db *gorm.DB, user int64) ([]perm.Role, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListUserRolesTx(db, user)
+}
+
+func RBAC0ListRoleUsers(db *gorm.DB, role perm.Role) ([]int64, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListRoleUsersTx(db, role)
+}
+
+func RBAC0CheckUserPerm(db *gorm.DB, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error) {
+	if _rbac0Ctl == nil {
+		return false, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CheckUserPermTx(db, domain, user, obj, act)
+}
+
+func RBAC0CreateSession(db *gorm.DB, domain perm.Domain, user int64, roles ...perm.Role) (int64, error) {
+	if _rbac0Ctl == nil {
+		return 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CreateSessionTx(db, domain, user, roles...)
+}
+
+func RBAC0AddActiveRole(db *gorm.DB, session int64, role perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.AddActiveRoleTx(db, session, role)
+}
+
+func RBAC0DropActiveRole(db *gorm.DB, session int64, role perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DropActiveRoleTx(db, session, role)
+}
+
+func RBAC0GetSession(db *gorm.DB, session int64) (*perm.SessionInfo, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.GetSessionTx(db, session)
+}
+
+func RBAC0ListSessionRoles(db *gorm.DB, session int64) ([]perm.Role, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListSessionRolesTx(db, session)
+}
+
+func RBAC0DeleteSession(db *gorm.DB, session int64) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DeleteSessionTx(db, session)
+}
+
+func RBAC0CheckSessionPerm(db *gorm.DB, session int64, obj perm.Obj, act perm.Act) (bool, error) {
+	if _rbac0Ctl == nil {
+		return false, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CheckSessionPermTx(db, session, obj, act)
+}
+
+func RBAC0AddInheritance(db *gorm.DB, parent, child perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.AddInheritanceTx(db, parent, child)
+}
+
+func RBAC0DeleteInheritance(db *gorm.DB, parent, child perm.Role) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DeleteInheritanceTx(db, parent, child)
+}
+
+func RBAC0ListAncestors(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListAncestorsTx(db, role)
+}
+
+func RBAC0ListDescendants(db *gorm.DB, role perm.Role) ([]perm.Role, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListDescendantsTx(db, role)
+}
+
+func RBAC0CreateSSDSet(db *gorm.DB, name string, roles []perm.Role, cardinality int) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CreateSSDSetTx(db, name, roles, cardinality)
+}
+
+func RBAC0DeleteSSDSet(db *gorm.DB, name string) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DeleteSSDSetTx(db, name)
+}
+
+func RBAC0ListSSDSets(db *gorm.DB) ([]*perm.SSDSet, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListSSDSetsTx(db)
+}
+
+func RBAC0CreateDSDSet(db *gorm.DB, name string, roles []perm.Role, cardinality int) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.CreateDSDSetTx(db, name, roles, cardinality)
+}
+
+func RBAC0DeleteDSDSet(db *gorm.DB, name string) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.DeleteDSDSetTx(db, name)
+}
+
+func RBAC0ListDSDSets(db *gorm.DB) ([]*perm.DSDSet, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListDSDSetsTx(db)
+}
+
+func RBAC0ListAuditLogs(db *gorm.DB, q audit.Query) ([]*audit.Entry, int64, error) {
+	if _rbac0Ctl == nil {
+		return nil, 0, errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.ListAuditLogsTx(db, q)
+}
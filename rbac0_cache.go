@@ -0,0 +1,571 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
+	"gorm.io/gorm"
+)
+
+// RBAC0CacheStats 缓存统计
+type RBAC0CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+}
+
+// CachedRBAC0Controller 带进程内缓存的RBAC0权限控制器，可包装任意 IRBAC0Controller
+// 缓存角色状态、角色权限(含继承权限)、继承关系与动态职责分离约束，用于 CheckPerm / CheckPermWithAttrs / CheckPerms
+// 经由本控制器的修改会精确失效受影响的角色(角色自身及继承了该角色的角色)
+// 注意：
+// 1. 绕过本控制器的修改(包括其他进程)不会使缓存失效，需调用 Invalidate / InvalidateAll，或订阅Watcher的变更：
+// 创建时订阅被包装的控制器已有的Watcher(例如casbin实现默认的数据库轮询)，之后可通过 SetWatcher 替换
+// 2. Tx方法在调用返回时即失效缓存，调用方事务提交前并发加载的旧数据可能被缓存，可在提交后调用 Invalidate，或使用 Transaction；
+// 设置Watcher后，事务提交后收到的变更会再次失效缓存
+// 3. 缓存按 perm.Perm.Applies 在本地求值，被包装的控制器使用自定义casbin matcher或policy effect时不缓存，检查直接交由被包装的控制器；
+// 本地求值时不支持 AddMatcherFunction
+type CachedRBAC0Controller struct {
+	IRBAC0Controller
+
+	mu sync.RWMutex
+	// 每次失效递增，用于丢弃失效前开始加载的数据
+	version uint64
+	roles   map[perm.Role]*rbac0CacheEntry
+	dsdSets []*perm.DSDSet
+	dsdOK   bool
+
+	hits          uint64
+	misses        uint64
+	invalidations uint64
+
+	// 取消订阅当前Watcher
+	subMu       sync.Mutex
+	unsubscribe func()
+}
+
+type rbac0CacheEntry struct {
+	rolePerms   *perm.RolePerms
+	descendants []perm.Role
+}
+
+// NewCachedRBAC0Controller 为ctl添加进程内缓存，ctl已设置Watcher时订阅其变更
+func NewCachedRBAC0Controller(ctl IRBAC0Controller) *CachedRBAC0Controller {
+	c := &CachedRBAC0Controller{
+		IRBAC0Controller: ctl,
+		roles:            make(map[perm.Role]*rbac0CacheEntry),
+	}
+	if w := controllerWatcher(ctl); w != nil {
+		c.subscribe(w)
+	}
+	return c
+}
+
+// Stats 查询缓存命中统计
+func (c *CachedRBAC0Controller) Stats() RBAC0CacheStats {
+	return RBAC0CacheStats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+	}
+}
+
+// Invalidate 失效roles及继承了roles的角色的缓存
+func (c *CachedRBAC0Controller) Invalidate(roles ...perm.Role) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	for _, role := range roles {
+		delete(c.roles, role)
+		for r, e := range c.roles {
+			for _, descendant := range e.descendants {
+				if descendant == role {
+					delete(c.roles, r)
+					break
+				}
+			}
+		}
+	}
+	atomic.AddUint64(&c.invalidations, 1)
+}
+
+// InvalidateAll 失效所有缓存
+func (c *CachedRBAC0Controller) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.roles = make(map[perm.Role]*rbac0CacheEntry)
+	c.dsdSets = nil
+	c.dsdOK = false
+	atomic.AddUint64(&c.invalidations, 1)
+}
+
+func (c *CachedRBAC0Controller) invalidateDSD() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.dsdSets = nil
+	c.dsdOK = false
+	atomic.AddUint64(&c.invalidations, 1)
+}
+
+// SetWatcher 为被包装的控制器设置Watcher，取消订阅之前的Watcher，并在收到变更时失效缓存
+func (c *CachedRBAC0Controller) SetWatcher(w watcher.Watcher) {
+	c.IRBAC0Controller.SetWatcher(w)
+	c.subscribe(w)
+}
+
+// Watcher 被包装的控制器的Watcher，未设置时为nil
+func (c *CachedRBAC0Controller) Watcher() watcher.Watcher {
+	return controllerWatcher(c.IRBAC0Controller)
+}
+
+// Close 取消订阅Watcher，关闭被包装的控制器并清空缓存
+func (c *CachedRBAC0Controller) Close(ctx context.Context) error {
+	c.subMu.Lock()
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+		c.unsubscribe = nil
+	}
+	c.subMu.Unlock()
+	defer c.InvalidateAll()
+	return c.IRBAC0Controller.Close(ctx)
+}
+
+// BuiltinMatcher 被包装的控制器的权限判定是否与 perm.Perm.Applies 一致，不一致时不缓存
+func (c *CachedRBAC0Controller) BuiltinMatcher() bool {
+	return builtinMatcher(c.IRBAC0Controller)
+}
+
+// AddMatcherFunction 本地求值时不会调用matcher函数，因此仅在不缓存时注册，注册后失效所有缓存
+func (c *CachedRBAC0Controller) AddMatcherFunction(name string, fn func(args ...interface{}) (interface{}, error)) error {
+	if c.BuiltinMatcher() {
+		return fmt.Errorf("%w: matcher function by rbac0 cache with builtin matcher", errs.ErrNotSupported)
+	}
+	defer c.InvalidateAll()
+	return c.IRBAC0Controller.AddMatcherFunction(name, fn)
+}
+
+// Transaction 事务提交或回滚后失效所有缓存，避免缓存事务中加载的数据
+func (c *CachedRBAC0Controller) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	defer c.InvalidateAll()
+	return c.IRBAC0Controller.Transaction(ctx, fn)
+}
+
+func (c *CachedRBAC0Controller) TransactionTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	defer c.InvalidateAll()
+	return c.IRBAC0Controller.TransactionTx(db, fn)
+}
+
+// --- check ---
+
+func (c *CachedRBAC0Controller) CheckPerm(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return c.CheckPermWithAttrs(ctx, domain, role, obj, act, nil)
+}
+
+func (c *CachedRBAC0Controller) CheckPermTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	return c.CheckPermWithAttrsTx(db, domain, role, obj, act, nil)
+}
+
+func (c *CachedRBAC0Controller) CheckPermWithAttrs(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	if !c.BuiltinMatcher() {
+		return c.IRBAC0Controller.CheckPermWithAttrs(ctx, domain, role, obj, act, attrs)
+	}
+	return c.checkPerm(&rbac0CtxLoader{ctl: c.IRBAC0Controller, ctx: ctx}, domain, role, obj, act, attrs)
+}
+
+func (c *CachedRBAC0Controller) CheckPermWithAttrsTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	if !c.BuiltinMatcher() {
+		return c.IRBAC0Controller.CheckPermWithAttrsTx(db, domain, role, obj, act, attrs)
+	}
+	return c.checkPerm(&rbac0TxLoader{ctl: c.IRBAC0Controller, db: db}, domain, role, obj, act, attrs)
+}
+
+func (c *CachedRBAC0Controller) CheckPerms(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	if !c.BuiltinMatcher() {
+		return c.IRBAC0Controller.CheckPerms(ctx, domain, roles, obj, act)
+	}
+	return c.checkPerms(&rbac0CtxLoader{ctl: c.IRBAC0Controller, ctx: ctx}, domain, roles, obj, act)
+}
+
+func (c *CachedRBAC0Controller) CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	if !c.BuiltinMatcher() {
+		return c.IRBAC0Controller.CheckPermsTx(db, domain, roles, obj, act)
+	}
+	return c.checkPerms(&rbac0TxLoader{ctl: c.IRBAC0Controller, db: db}, domain, roles, obj, act)
+}
+
+// --- mutation ---
+
+func (c *CachedRBAC0Controller) UpdateRole(ctx context.Context, role perm.Role, name, desc string) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.UpdateRole(ctx, role, name, desc)
+}
+
+func (c *CachedRBAC0Controller) UpdateRoleTx(db *gorm.DB, role perm.Role, name, desc string) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.UpdateRoleTx(db, role, name, desc)
+}
+
+// DeleteRole 角色同时从动态职责分离约束中删除，因此同时失效约束的缓存
+func (c *CachedRBAC0Controller) DeleteRole(ctx context.Context, role perm.Role) error {
+	defer c.invalidateDSD()
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.DeleteRole(ctx, role)
+}
+
+func (c *CachedRBAC0Controller) DeleteRoleTx(db *gorm.DB, role perm.Role) error {
+	defer c.invalidateDSD()
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.DeleteRoleTx(db, role)
+}
+
+func (c *CachedRBAC0Controller) GrantRolePerms(ctx context.Context, role perm.Role, perms []perm.Perm) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.GrantRolePerms(ctx, role, perms)
+}
+
+func (c *CachedRBAC0Controller) GrantRolePermsTx(db *gorm.DB, role perm.Role, perms []perm.Perm) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.GrantRolePermsTx(db, role, perms)
+}
+
+func (c *CachedRBAC0Controller) RevokeRolePerms(ctx context.Context, role perm.Role, perms []perm.Perm) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.RevokeRolePerms(ctx, role, perms)
+}
+
+func (c *CachedRBAC0Controller) RevokeRolePermsTx(db *gorm.DB, role perm.Role, perms []perm.Perm) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.RevokeRolePermsTx(db, role, perms)
+}
+
+func (c *CachedRBAC0Controller) CleanRolePerms(ctx context.Context, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.CleanRolePerms(ctx, role)
+}
+
+func (c *CachedRBAC0Controller) CleanRolePermsTx(db *gorm.DB, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.CleanRolePermsTx(db, role)
+}
+
+func (c *CachedRBAC0Controller) SweepExpiredPerms(ctx context.Context) (int64, error) {
+	count, err := c.IRBAC0Controller.SweepExpiredPerms(ctx)
+	if count > 0 {
+		c.InvalidateAll()
+	}
+	return count, err
+}
+
+func (c *CachedRBAC0Controller) SweepExpiredPermsTx(db *gorm.DB) (int64, error) {
+	count, err := c.IRBAC0Controller.SweepExpiredPermsTx(db)
+	if count > 0 {
+		c.InvalidateAll()
+	}
+	return count, err
+}
+
+func (c *CachedRBAC0Controller) EnableRole(ctx context.Context, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.EnableRole(ctx, role)
+}
+
+func (c *CachedRBAC0Controller) EnableRoleTx(db *gorm.DB, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.EnableRoleTx(db, role)
+}
+
+func (c *CachedRBAC0Controller) DisableRole(ctx context.Context, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.DisableRole(ctx, role)
+}
+
+func (c *CachedRBAC0Controller) DisableRoleTx(db *gorm.DB, role perm.Role) error {
+	defer c.Invalidate(role)
+	return c.IRBAC0Controller.DisableRoleTx(db, role)
+}
+
+func (c *CachedRBAC0Controller) AddInheritance(ctx context.Context, parent, child perm.Role) error {
+	defer c.Invalidate(parent)
+	return c.IRBAC0Controller.AddInheritance(ctx, parent, child)
+}
+
+func (c *CachedRBAC0Controller) AddInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	defer c.Invalidate(parent)
+	return c.IRBAC0Controller.AddInheritanceTx(db, parent, child)
+}
+
+func (c *CachedRBAC0Controller) DeleteInheritance(ctx context.Context, parent, child perm.Role) error {
+	defer c.Invalidate(parent)
+	return c.IRBAC0Controller.DeleteInheritance(ctx, parent, child)
+}
+
+func (c *CachedRBAC0Controller) DeleteInheritanceTx(db *gorm.DB, parent, child perm.Role) error {
+	defer c.Invalidate(parent)
+	return c.IRBAC0Controller.DeleteInheritanceTx(db, parent, child)
+}
+
+func (c *CachedRBAC0Controller) CreateDSDSet(ctx context.Context, name string, roles []perm.Role, cardinality int) error {
+	defer c.invalidateDSD()
+	return c.IRBAC0Controller.CreateDSDSet(ctx, name, roles, cardinality)
+}
+
+func (c *CachedRBAC0Controller) CreateDSDSetTx(db *gorm.DB, name string, roles []perm.Role, cardinality int) error {
+	defer c.invalidateDSD()
+	return c.IRBAC0Controller.CreateDSDSetTx(db, name, roles, cardinality)
+}
+
+func (c *CachedRBAC0Controller) DeleteDSDSet(ctx context.Context, name string) error {
+	defer c.invalidateDSD()
+	return c.IRBAC0Controller.DeleteDSDSet(ctx, name)
+}
+
+func (c *CachedRBAC0Controller) DeleteDSDSetTx(db *gorm.DB, name string) error {
+	defer c.invalidateDSD()
+	return c.IRBAC0Controller.DeleteDSDSetTx(db, name)
+}
+
+// --- internal method ---
+
+// subscribe 订阅w的变更并取消订阅之前的Watcher，收到变更时失效缓存
+func (c *CachedRBAC0Controller) subscribe(w watcher.Watcher) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+	c.unsubscribe = w.Subscribe(func(ev watcher.Event) {
+		if ev.All() {
+			c.InvalidateAll()
+		} else {
+			c.Invalidate(ev.Roles...)
+		}
+	})
+}
+
+// checkPerm 与各实现的 CheckPerm 语义一致：域不可见的角色视为不存在，拒绝优先，内置admin不受拒绝权限约束
+func (c *CachedRBAC0Controller) checkPerm(l rbac0Loader, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	e, err := c.entry(l, role)
+	if err != nil {
+		return false, false, false, err
+	}
+	allow, deny, err := e.check(domain, obj, act, attrs)
+	if err != nil {
+		return false, false, false, err
+	}
+	return allow && !deny, e.rolePerms.Enable, e.rolePerms.IsAdmin, nil
+}
+
+func (c *CachedRBAC0Controller) checkPerms(l rbac0Loader, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	entries := make([]*rbac0CacheEntry, 0, len(roles))
+	for _, role := range roles {
+		e, err := c.entry(l, role)
+		if err != nil {
+			return false, err
+		}
+		entries = append(entries, e)
+	}
+	if err := c.checkDSD(l, entries); err != nil {
+		return false, err
+	}
+	var allowed, denied bool
+	for _, e := range entries {
+		allow, deny, err := e.check(domain, obj, act, nil)
+		if err != nil {
+			return false, err
+		}
+		if e.rolePerms.Enable && e.rolePerms.IsAdmin {
+			return true, nil
+		}
+		allowed = allowed || allow
+		denied = denied || deny
+	}
+	return allowed && !denied, nil
+}
+
+// checkDSD 检查同时激活的角色(含继承角色)是否违反动态职责分离约束
+func (c *CachedRBAC0Controller) checkDSD(l rbac0Loader, entries []*rbac0CacheEntry) error {
+	sets, err := c.dsd(l)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+	active := make(map[perm.Role]bool)
+	for _, e := range entries {
+		active[e.rolePerms.Role] = true
+		for _, descendant := range e.descendants {
+			active[descendant] = true
+		}
+	}
+	for _, set := range sets {
+		var conflicts []perm.Role
+		for _, role := range set.Roles {
+			if active[role] {
+				conflicts = append(conflicts, role)
+			}
+		}
+		if len(conflicts) >= set.Cardinality {
+			return &perm.DSDViolationError{
+				Set:         set.Name,
+				Cardinality: set.Cardinality,
+				Roles:       conflicts,
+			}
+		}
+	}
+	return nil
+}
+
+func (c *CachedRBAC0Controller) entry(l rbac0Loader, role perm.Role) (*rbac0CacheEntry, error) {
+	c.mu.RLock()
+	e, ok := c.roles[role]
+	version := c.version
+	c.mu.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return e, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	rolePerms, err := l.GetRolePerms(role)
+	if err != nil {
+		return nil, err
+	}
+	descendants, err := l.ListDescendants(role)
+	if err != nil {
+		return nil, err
+	}
+	e = &rbac0CacheEntry{rolePerms: rolePerms, descendants: descendants}
+	c.mu.Lock()
+	if c.version == version {
+		c.roles[role] = e
+	}
+	c.mu.Unlock()
+	return e, nil
+}
+
+func (c *CachedRBAC0Controller) dsd(l rbac0Loader) ([]*perm.DSDSet, error) {
+	c.mu.RLock()
+	sets, ok := c.dsdSets, c.dsdOK
+	version := c.version
+	c.mu.RUnlock()
+	if ok {
+		return sets, nil
+	}
+	sets, err := l.ListDSDSets()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.version == version {
+		c.dsdSets, c.dsdOK = sets, true
+	}
+	c.mu.Unlock()
+	return sets, nil
+}
+
+// check 返回是否匹配到允许、拒绝的权限
+func (e *rbac0CacheEntry) check(domain perm.Domain, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, error) {
+	if !inDomain(e.rolePerms.Domain, domain) {
+		// 与控制器一致：角色不在domain中视为角色不存在
+		return false, false, fmt.Errorf("%w: %w", errs.ErrRoleNotFound, gorm.ErrRecordNotFound)
+	}
+	if !e.rolePerms.Enable {
+		return false, false, nil
+	}
+	if e.rolePerms.IsAdmin {
+		return true, false, nil
+	}
+	var allow, deny bool
+	now := time.Now().UnixMilli()
+	for _, perms := range [][]perm.Perm{e.rolePerms.Perms, e.rolePerms.InheritedPerms} {
+		for _, p := range perms {
+			if inDomain(p.Domain, domain) && p.Applies(obj, act, now, attrs) {
+				if p.Effect == perm.EffectDeny {
+					deny = true
+				} else {
+					allow = true
+				}
+			}
+		}
+	}
+	return allow, deny, nil
+}
+
+// --- internal function ---
+
+// rbac0BuiltinMatcher 可选接口，见 CachedRBAC0Controller.BuiltinMatcher
+type rbac0BuiltinMatcher interface {
+	BuiltinMatcher() bool
+}
+
+// builtinMatcher ctl的权限判定是否与 perm.Perm.Applies 一致，未实现 rbac0BuiltinMatcher 的控制器视为一致
+func builtinMatcher(ctl IRBAC0Controller) bool {
+	m, ok := ctl.(rbac0BuiltinMatcher)
+	return !ok || m.BuiltinMatcher()
+}
+
+// rbac0Watcher 可选接口，查询控制器的Watcher，见 rbac0common.Store.Watcher
+type rbac0Watcher interface {
+	Watcher() watcher.Watcher
+}
+
+// controllerWatcher ctl已设置的Watcher，未设置或未实现 rbac0Watcher 时为nil
+func controllerWatcher(ctl IRBAC0Controller) watcher.Watcher {
+	if w, ok := ctl.(rbac0Watcher); ok {
+		return w.Watcher()
+	}
+	return nil
+}
+
+// inDomain 属于d的角色或权限是否在domain中生效
+func inDomain(d, domain perm.Domain) bool {
+	return d == perm.GlobalDomain || d == domain
+}
+
+// rbac0Loader 缓存未命中时的加载方式(ctx或调用方的db)
+type rbac0Loader interface {
+	GetRolePerms(role perm.Role) (*perm.RolePerms, error)
+	ListDescendants(role perm.Role) ([]perm.Role, error)
+	ListDSDSets() ([]*perm.DSDSet, error)
+}
+
+type rbac0CtxLoader struct {
+	ctl IRBAC0Controller
+	ctx context.Context
+}
+
+func (l *rbac0CtxLoader) GetRolePerms(role perm.Role) (*perm.RolePerms, error) {
+	return l.ctl.GetRolePerms(l.ctx, role)
+}
+
+func (l *rbac0CtxLoader) ListDescendants(role perm.Role) ([]perm.Role, error) {
+	return l.ctl.ListDescendants(l.ctx, role)
+}
+
+func (l *rbac0CtxLoader) ListDSDSets() ([]*perm.DSDSet, error) {
+	return l.ctl.ListDSDSets(l.ctx)
+}
+
+type rbac0TxLoader struct {
+	ctl IRBAC0Controller
+	db  *gorm.DB
+}
+
+func (l *rbac0TxLoader) GetRolePerms(role perm.Role) (*perm.RolePerms, error) {
+	return l.ctl.GetRolePermsTx(l.db, role)
+}
+
+func (l *rbac0TxLoader) ListDescendants(role perm.Role) ([]perm.Role, error) {
+	return l.ctl.ListDescendantsTx(l.db, role)
+}
+
+func (l *rbac0TxLoader) ListDSDSets() ([]*perm.DSDSet, error) {
+	return l.ctl.ListDSDSetsTx(l.db)
+}
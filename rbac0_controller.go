@@ -2,28 +2,73 @@ package access
 
 import (
 	"context"
+	"io/fs"
 
+	"github.com/casbin/casbin/v2/model"
 	access_rbac0 "github.com/gromitlee/access/internal/ctl/access/rbac0"
 	casbin_rbac0 "github.com/gromitlee/access/internal/ctl/casbin/rbac0"
+	"github.com/gromitlee/access/pkg/audit"
 	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
 	"gorm.io/gorm"
 )
 
 // IRBAC0Controller RBAC0权限控制器 interface
+// 返回的错误可通过 errors.Is 与 errs 包中的错误判断，access与casbin实现一致，例如角色不存在时为 errs.ErrRoleNotFound
 type IRBAC0Controller interface {
-	// CheckPerm 检查权限
+	// SetWatcher 设置跨实例变更通知，须在使用控制器前调用，之前设置的Watcher被关闭
+	// 修改角色、权限、继承关系与动态职责分离约束时，在同一事务中向w发布变更
+	// casbin实现收到变更时重新加载policy(默认使用 watcher.DBWatcher 轮询)，CachedRBAC0Controller 收到变更时失效缓存
+	SetWatcher(w watcher.Watcher)
+	// Close 关闭 SetWatcher 设置的Watcher(casbin实现包括默认的Watcher)，停止接收变更
+	// 可重复调用，ctx结束时不再等待并返回ctx的错误；关闭后不应再使用控制器
+	Close(ctx context.Context) error
+	// Health 检查控制器是否可用：未关闭且数据库连接正常
+	Health(ctx context.Context) error
+	// Transaction 在同一事务中执行fn，fn中通过tx调用的Tx方法全部提交或全部回滚
+	// casbin实现的policy通过tx写入数据库，事务提交后才应用到内存中的enforcer；
+	// 直接将调用方的事务传给Tx方法时，policy在Tx方法返回时即应用到内存，调用方回滚后需等待下次加载policy才能恢复
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	TransactionTx(db *gorm.DB, fn func(tx *gorm.DB) error) error
+	// AddMatcherFunction 注册可在casbin model的matcher中调用的函数(例如 regexMatch 之外的自定义匹配)，须在首次检查权限前注册
+	// 函数签名与casbin AddFunction 一致；同名函数只能注册一次；access实现不使用model，返回错误
+	AddMatcherFunction(name string, fn func(args ...interface{}) (interface{}, error)) error
+
+	// CheckPerm 在domain中检查权限，包括通过角色继承获得的权限
+	// role须为全局角色或属于domain，否则视为角色不存在；仅全局权限与属于domain的权限生效
+	// 权限的Obj与Act支持通配符模式(见 perm.Perm.Match)，多个权限同时匹配时拒绝优先(deny-overrides)
+	// 内置admin角色不受拒绝权限约束
 	// 返回 ok, enable, isAdmin, err
-	CheckPerm(ctx context.Context, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error)
-	CheckPermTx(db *gorm.DB, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error)
-	// CheckPerms 检查权限，有一个role有权限即为true(例如一个用户是多个角色的情况)
-	CheckPerms(ctx context.Context, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error)
-	CheckPermsTx(db *gorm.DB, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error)
+	CheckPerm(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error)
+	CheckPermTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error)
+	// CheckPermWithAttrs 同 CheckPerm，带条件(Cond)的权限按attrs求值(见 perm.Perm.MatchCond)
+	// CheckPerm 等同于attrs为空，此时依赖属性的条件无法求值：允许权限视为不匹配，拒绝权限视为匹配
+	CheckPermWithAttrs(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error)
+	CheckPermWithAttrsTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error)
+	// CheckPerms 在domain中检查权限，有一个role有权限且没有role拒绝即为true(例如一个用户是多个角色的情况)
+	// 有一个启用的内置admin角色即为true
+	// roles视为同时激活，违反动态职责分离约束时返回 *perm.DSDViolationError
+	CheckPerms(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error)
+	CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error)
+	// Decide 同 CheckPerm，返回带原因的判定结果(见 perm.Decision)，角色不存在时不返回错误而是 perm.ReasonRoleNotFound
+	// 需要以错误形式返回拒绝原因时使用 perm.Decision.Err
+	Decide(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error)
+	DecideTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error)
+	// DecideMany 同 CheckPerms，返回合并后的判定结果(见 perm.CombineDecisions)
+	DecideMany(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error)
+	DecideManyTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error)
+	// Explain 同 DecideMany，返回逐步的检查过程(角色查询、启用/admin状态、继承角色、候选权限及其匹配情况)
+	// 可通过 perm.Trace 的 String 或 JSON 展示；违反动态职责分离约束时同时返回trace与 *perm.DSDViolationError
+	// casbin实现的判定结果以model的matcher为准，候选权限的匹配情况按内置规则(见 perm.Perm.Applies)展示
+	Explain(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error)
+	ExplainTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Trace, error)
 
 	// CreateRole 创建角色
-	// 当role为0时，由系统分配role的枚举值；role非0适用于系统已经固定角色枚举值，不需要动态创建角色的需求
-	// 当isAdmin为true时，该角色(内置admin)具有一切权限
-	CreateRole(ctx context.Context, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error)
-	CreateRoleTx(db *gorm.DB, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error)
+	// 当role为0时，由系统分配role的枚举值；role非0适用于系统已经固定角色枚举值，不需要动态创建角色的需求，role已存在时返回 errs.ErrRoleExists
+	// 当isAdmin为true时，该角色(内置admin)在其生效的域中具有一切权限
+	// 当domain为 perm.GlobalDomain 时为全局角色，在所有域中生效；否则为域角色，仅在domain中生效；"*"为保留的域名，返回 errs.ErrInvalidDomain
+	CreateRole(ctx context.Context, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error)
+	CreateRoleTx(db *gorm.DB, domain perm.Domain, role perm.Role, creator int64, name, desc string, isAdmin bool, perms ...perm.Perm) (*perm.RolePerms, error)
 	// UpdateRole 更新角色
 	UpdateRole(ctx context.Context, role perm.Role, name, desc string) error
 	UpdateRoleTx(db *gorm.DB, role perm.Role, name, desc string) error
@@ -31,9 +76,22 @@ type IRBAC0Controller interface {
 	DeleteRole(ctx context.Context, role perm.Role) error
 	DeleteRoleTx(db *gorm.DB, role perm.Role) error
 
-	// ListRoleInfo 查询角色列表
-	ListRoleInfo(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error)
-	ListRoleInfoTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error)
+	// ListRoleInfo 查询角色列表，更多过滤与排序条件见 QueryRoleInfo
+	// enable大于0、小于0分别查询启用、未启用的角色，order小于0时按id倒序
+	// domain非空时仅查询在domain中生效的角色(全局角色与domain的角色)，为空时不按域过滤
+	// offset小于0或limit不为正数(-1表示不限制)时返回 errs.ErrInvalidPagination
+	ListRoleInfo(ctx context.Context, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error)
+	ListRoleInfoTx(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RoleInfo, int64, error)
+	// QueryRoleInfo 按 perm.RoleQuery 查询角色列表，返回角色与总数
+	// 可按域、角色集合、角色名、启用/admin状态、创建用户、创建时间与直接授予的权限过滤，按 perm.RoleSortField 排序
+	// 查询条件不合法时返回 errs.ErrInvalidQuery 或 errs.ErrInvalidPagination；游标分页见 PageRoleInfo
+	QueryRoleInfo(ctx context.Context, q perm.RoleQuery) ([]*perm.RoleInfo, int64, error)
+	QueryRoleInfoTx(db *gorm.DB, q perm.RoleQuery) ([]*perm.RoleInfo, int64, error)
+	// PageRoleInfo 按 perm.RoleQuery 游标分页查询角色列表，q.Cursor为上一页返回的 perm.Page.Next
+	// 按排序字段与id定位下一页，不使用offset，并发插入时不会重复或遗漏；q.WithCount为true时才查询总数
+	// q.Limit为0时返回全部角色；游标无法解析或与排序条件不一致时返回 errs.ErrInvalidCursor
+	PageRoleInfo(ctx context.Context, q perm.RoleQuery) (*perm.Page[*perm.RoleInfo], error)
+	PageRoleInfoTx(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RoleInfo], error)
 	// GetRoleInfo 查询角色信息
 	GetRoleInfo(ctx context.Context, role perm.Role) (*perm.RoleInfo, error)
 	GetRoleInfoTx(db *gorm.DB, role perm.Role) (*perm.RoleInfo, error)
@@ -41,22 +99,39 @@ type IRBAC0Controller interface {
 	GetRoleInfos(ctx context.Context, roles []perm.Role, order int64) ([]*perm.RoleInfo, error)
 	GetRoleInfosTx(db *gorm.DB, roles []perm.Role, order int64) ([]*perm.RoleInfo, error)
 
-	// ListRolePerms 查询角色列表
-	ListRolePerms(ctx context.Context, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error)
-	ListRolePermsTx(db *gorm.DB, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error)
-	// GetRolePerms 查询角色权限
+	// ListRolePerms 查询角色列表，参数同 ListRoleInfo，更多过滤与排序条件见 QueryRolePerms
+	// domain非空时仅查询在domain中生效的角色与权限，为空时不按域过滤
+	ListRolePerms(ctx context.Context, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error)
+	ListRolePermsTx(db *gorm.DB, domain perm.Domain, name string, enable int32, offset, limit, order int64) ([]*perm.RolePerms, int64, error)
+	// QueryRolePerms 同 QueryRoleInfo，返回角色权限；q.Domain非空时仅返回在q.Domain中生效的权限
+	QueryRolePerms(ctx context.Context, q perm.RoleQuery) ([]*perm.RolePerms, int64, error)
+	QueryRolePermsTx(db *gorm.DB, q perm.RoleQuery) ([]*perm.RolePerms, int64, error)
+	// PageRolePerms 同 PageRoleInfo，返回角色权限
+	PageRolePerms(ctx context.Context, q perm.RoleQuery) (*perm.Page[*perm.RolePerms], error)
+	PageRolePermsTx(db *gorm.DB, q perm.RoleQuery) (*perm.Page[*perm.RolePerms], error)
+	// GetRolePerms 查询角色权限，通过角色继承获得的权限见 perm.RolePerms.InheritedPerms
+	// 返回的权限包含有效期(NotBefore/ExpiresAt)，即将过期的权限见 perm.RolePerms.ExpiringPerms
 	GetRolePerms(ctx context.Context, role perm.Role) (*perm.RolePerms, error)
 	GetRolePermsTx(db *gorm.DB, role perm.Role) (*perm.RolePerms, error)
 
 	// GrantRolePerms 授予角色权限，会自动去重，对内置admin无效
+	// 全局角色可被授予任意域的权限；域角色只能被授予本域的权限，未指定域的权限归属角色所在的域
+	// Obj与Act可以是通配符模式，例如 perm.Perm{Obj: "project/*", Act: "*"}
+	// 可指定有效期(NotBefore/ExpiresAt)，有效期外的权限在检查时被忽略；重复授予时更新有效期
+	// 可指定条件表达式(Cond)，例如 perm.Perm{Obj: "invoice", Act: "approve", Cond: "amount < 10000"}，无法解析时返回错误
+	// 条件不同的权限视为不同的权限
 	GrantRolePerms(ctx context.Context, role perm.Role, perms []perm.Perm) error
 	GrantRolePermsTx(db *gorm.DB, role perm.Role, perms []perm.Perm) error
-	// RevokeRolePerms 撤销角色权限
+	// RevokeRolePerms 撤销角色权限，不区分有效期
 	RevokeRolePerms(ctx context.Context, role perm.Role, perms []perm.Perm) error
 	RevokeRolePermsTx(db *gorm.DB, role perm.Role, perms []perm.Perm) error
 	// CleanRolePerms 清除角色所有权限(对内置admin无效)
 	CleanRolePerms(ctx context.Context, role perm.Role) error
 	CleanRolePermsTx(db *gorm.DB, role perm.Role) error
+	// SweepExpiredPerms 物理删除所有已过期的权限，返回删除的数量
+	// 可通过 RunRBAC0PermSweeper 周期性执行
+	SweepExpiredPerms(ctx context.Context) (int64, error)
+	SweepExpiredPermsTx(db *gorm.DB) (int64, error)
 
 	// EnableRole 启用角色，新增角色默认启用
 	EnableRole(ctx context.Context, role perm.Role) error
@@ -64,11 +139,128 @@ type IRBAC0Controller interface {
 	// DisableRole 禁用角色
 	DisableRole(ctx context.Context, role perm.Role) error
 	DisableRoleTx(db *gorm.DB, role perm.Role) error
+
+	// AssignUserRoles 为用户分配角色，会自动去重
+	AssignUserRoles(ctx context.Context, user int64, roles []perm.Role) error
+	AssignUserRolesTx(db *gorm.DB, user int64, roles []perm.Role) error
+	// DeassignUserRoles 撤销用户角色，同时在该用户的所有会话中取消激活这些角色
+	DeassignUserRoles(ctx context.Context, user int64, roles []perm.Role) error
+	DeassignUserRolesTx(db *gorm.DB, user int64, roles []perm.Role) error
+	// ListUserRoles 查询用户已分配的角色
+	ListUserRoles(ctx context.Context, user int64) ([]perm.Role, error)
+	ListUserRolesTx(db *gorm.DB, user int64) ([]perm.Role, error)
+	// ListRoleUsers 查询已分配角色的用户
+	ListRoleUsers(ctx context.Context, role perm.Role) ([]int64, error)
+	ListRoleUsersTx(db *gorm.DB, role perm.Role) ([]int64, error)
+	// CheckUserPerm 在domain中检查用户权限，用户已分配且在domain中生效的角色中有一个role有权限即为true
+	// 用户已分配的角色视为同时激活，受动态职责分离约束；需要分别激活互斥角色时请使用会话
+	CheckUserPerm(ctx context.Context, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error)
+	CheckUserPermTx(db *gorm.DB, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error)
+
+	// CreateSession 在domain中创建用户会话，返回会话id
+	// 会话默认不激活任何角色(最小权限)，可通过roles指定初始激活的角色
+	CreateSession(ctx context.Context, domain perm.Domain, user int64, roles ...perm.Role) (int64, error)
+	CreateSessionTx(db *gorm.DB, domain perm.Domain, user int64, roles ...perm.Role) (int64, error)
+	// AddActiveRole 在会话中激活角色，角色必须已分配给会话所属用户、在会话所在域中生效，且不得违反动态职责分离约束
+	AddActiveRole(ctx context.Context, session int64, role perm.Role) error
+	AddActiveRoleTx(db *gorm.DB, session int64, role perm.Role) error
+	// DropActiveRole 在会话中取消激活角色
+	DropActiveRole(ctx context.Context, session int64, role perm.Role) error
+	DropActiveRoleTx(db *gorm.DB, session int64, role perm.Role) error
+	// GetSession 查询会话信息，包括会话所在域与已激活的角色
+	GetSession(ctx context.Context, session int64) (*perm.SessionInfo, error)
+	GetSessionTx(db *gorm.DB, session int64) (*perm.SessionInfo, error)
+	// ListSessionRoles 查询会话已激活的角色
+	ListSessionRoles(ctx context.Context, session int64) ([]perm.Role, error)
+	ListSessionRolesTx(db *gorm.DB, session int64) ([]perm.Role, error)
+	// DeleteSession 删除会话
+	DeleteSession(ctx context.Context, session int64) error
+	DeleteSessionTx(db *gorm.DB, session int64) error
+	// CheckSessionPerm 在会话所在域中检查会话权限，仅会话已激活的角色参与检查
+	CheckSessionPerm(ctx context.Context, session int64, obj perm.Obj, act perm.Act) (bool, error)
+	CheckSessionPermTx(db *gorm.DB, session int64, obj perm.Obj, act perm.Act) (bool, error)
+
+	// AddInheritance 添加角色继承关系(RBAC1)，parent继承child的所有权限，不允许形成环
+	// 域角色只能被同域角色继承
+	AddInheritance(ctx context.Context, parent, child perm.Role) error
+	AddInheritanceTx(db *gorm.DB, parent, child perm.Role) error
+	// DeleteInheritance 删除角色继承关系
+	DeleteInheritance(ctx context.Context, parent, child perm.Role) error
+	DeleteInheritanceTx(db *gorm.DB, parent, child perm.Role) error
+	// ListAncestors 查询直接或间接继承role的所有角色
+	ListAncestors(ctx context.Context, role perm.Role) ([]perm.Role, error)
+	ListAncestorsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error)
+	// ListDescendants 查询role直接或间接继承的所有角色
+	ListDescendants(ctx context.Context, role perm.Role) ([]perm.Role, error)
+	ListDescendantsTx(db *gorm.DB, role perm.Role) ([]perm.Role, error)
+
+	// CreateSSDSet 创建静态职责分离约束(RBAC2 SSD)，用户被授权的角色(含继承角色)中属于roles的数量不得达到cardinality
+	// 用户角色分配与角色继承的变更违反约束时，返回 *perm.SSDViolationError(errors.Is(err, errs.ErrSSDViolation))
+	CreateSSDSet(ctx context.Context, name string, roles []perm.Role, cardinality int) error
+	CreateSSDSetTx(db *gorm.DB, name string, roles []perm.Role, cardinality int) error
+	// DeleteSSDSet 删除静态职责分离约束，约束不存在时返回 errs.ErrConstraintNotFound
+	DeleteSSDSet(ctx context.Context, name string) error
+	DeleteSSDSetTx(db *gorm.DB, name string) error
+	// ListSSDSets 查询所有静态职责分离约束
+	ListSSDSets(ctx context.Context) ([]*perm.SSDSet, error)
+	ListSSDSetsTx(db *gorm.DB) ([]*perm.SSDSet, error)
+
+	// CreateDSDSet 创建动态职责分离约束(RBAC2 DSD)，同时激活的角色(含继承角色)中属于roles的数量不得达到cardinality
+	// 会话激活角色与 CheckPerms 传入的角色列表违反约束时，返回 *perm.DSDViolationError(errors.Is(err, errs.ErrDSDViolation))
+	CreateDSDSet(ctx context.Context, name string, roles []perm.Role, cardinality int) error
+	CreateDSDSetTx(db *gorm.DB, name string, roles []perm.Role, cardinality int) error
+	// DeleteDSDSet 删除动态职责分离约束，约束不存在时返回 errs.ErrConstraintNotFound
+	DeleteDSDSet(ctx context.Context, name string) error
+	DeleteDSDSetTx(db *gorm.DB, name string) error
+	// ListDSDSets 查询所有动态职责分离约束
+	ListDSDSets(ctx context.Context) ([]*perm.DSDSet, error)
+	ListDSDSetsTx(db *gorm.DB) ([]*perm.DSDSet, error)
+
+	// ListAuditLogs 按条件(见 audit.Query)查询审计日志，返回日志与总数
+	// 修改角色、权限、用户角色分配、角色继承与职责分离约束的方法在同一事务中记录审计日志(含修改前后的角色权限)，会话的变更不记录
+	// 操作用户通过 audit.WithActor 设置在ctx中(Tx方法为 db.WithContext(ctx))，CreateRole未设置时记为creator
+	ListAuditLogs(ctx context.Context, q audit.Query) ([]*audit.Entry, int64, error)
+	ListAuditLogsTx(db *gorm.DB, q audit.Query) ([]*audit.Entry, int64, error)
 }
 
-// NewCasbinRBAC0Controller 基于 db + casbin 的RBAC0实现
+// CasbinRBAC0Model 内置的casbin RBAC0 model，可作为自定义model的模板
+var CasbinRBAC0Model = casbin_rbac0.DefaultModel
+
+// NewCasbinRBAC0Controller 基于 db + casbin 的RBAC0实现，从modelPath加载model，modelPath为空时使用内置的 CasbinRBAC0Model
 func NewCasbinRBAC0Controller(db *gorm.DB, modelPath string) (IRBAC0Controller, error) {
-	return casbin_rbac0.NewController(db, modelPath)
+	if modelPath == "" {
+		return NewCasbinRBAC0ControllerFromString(db, CasbinRBAC0Model)
+	}
+	m, err := model.NewModelFromFile(modelPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewCasbinRBAC0ControllerWithModel(db, m)
+}
+
+// NewCasbinRBAC0ControllerFromString 同 NewCasbinRBAC0Controller，从text加载model
+func NewCasbinRBAC0ControllerFromString(db *gorm.DB, text string) (IRBAC0Controller, error) {
+	m, err := model.NewModelFromString(text)
+	if err != nil {
+		return nil, err
+	}
+	return NewCasbinRBAC0ControllerWithModel(db, m)
+}
+
+// NewCasbinRBAC0ControllerFromFS 同 NewCasbinRBAC0Controller，从fsys中的path加载model(例如 embed.FS)
+func NewCasbinRBAC0ControllerFromFS(db *gorm.DB, fsys fs.FS, path string) (IRBAC0Controller, error) {
+	m, err := casbin_rbac0.NewModelFromFS(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewCasbinRBAC0ControllerWithModel(db, m)
+}
+
+// NewCasbinRBAC0ControllerWithModel 同 NewCasbinRBAC0Controller，使用已加载的model
+// model须与 CasbinRBAC0Model 兼容，否则返回错误：请求为 sub, dom, obj, act, env，policy为 sub, dom, obj, act, eft, ext，角色继承为 g = _, _，
+// matcher须调用 extMatch(p.eft, p.ext, r.env) 判断有效期与条件，可调用 AddMatcherFunction 注册的函数
+func NewCasbinRBAC0ControllerWithModel(db *gorm.DB, m model.Model) (IRBAC0Controller, error) {
+	return casbin_rbac0.NewController(db, m)
 }
 
 // NewAccessRBAC0Controller 基于 db 的RBAC0实现
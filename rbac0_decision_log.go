@@ -0,0 +1,200 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gromitlee/access/pkg/decisionlog"
+	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/watcher"
+	"gorm.io/gorm"
+)
+
+// LoggedRBAC0Controller 记录判定日志的RBAC0权限控制器，可包装任意 IRBAC0Controller
+// CheckPerm / CheckPermWithAttrs / CheckPerms / CheckUserPerm / CheckSessionPerm / Decide / DecideMany 的每次调用
+// 按 decisionlog.Options 过滤与采样后写入Logger，请求id通过 decisionlog.WithRequestID 设置在ctx中(Tx方法为 db.WithContext(ctx))
+// 与 CachedRBAC0Controller 同时使用时，应由本控制器包装缓存控制器，否则命中缓存的检查不会被记录
+type LoggedRBAC0Controller struct {
+	IRBAC0Controller
+
+	l *decisionlog.Logger
+}
+
+// NewLoggedRBAC0Controller 为ctl添加判定日志
+func NewLoggedRBAC0Controller(ctl IRBAC0Controller, l *decisionlog.Logger) *LoggedRBAC0Controller {
+	return &LoggedRBAC0Controller{
+		IRBAC0Controller: ctl,
+		l:                l,
+	}
+}
+
+// Logger 查询判定日志记录器
+func (c *LoggedRBAC0Controller) Logger() *decisionlog.Logger {
+	return c.l
+}
+
+// Close 关闭被包装的控制器与判定日志记录器，其中一个失败时仍关闭另一个
+func (c *LoggedRBAC0Controller) Close(ctx context.Context) error {
+	err := c.IRBAC0Controller.Close(ctx)
+	return errors.Join(err, c.l.Close())
+}
+
+// BuiltinMatcher 被包装的控制器的权限判定是否与 perm.Perm.Applies 一致，见 CachedRBAC0Controller
+func (c *LoggedRBAC0Controller) BuiltinMatcher() bool {
+	return builtinMatcher(c.IRBAC0Controller)
+}
+
+// Watcher 被包装的控制器的Watcher，未设置时为nil
+func (c *LoggedRBAC0Controller) Watcher() watcher.Watcher {
+	return controllerWatcher(c.IRBAC0Controller)
+}
+
+// --- check ---
+
+func (c *LoggedRBAC0Controller) CheckPerm(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	valid, enable, isAdmin, err := c.IRBAC0Controller.CheckPerm(ctx, domain, role, obj, act)
+	c.end(ctx, call, valid, err)
+	return valid, enable, isAdmin, err
+}
+
+func (c *LoggedRBAC0Controller) CheckPermTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (bool, bool, bool, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	valid, enable, isAdmin, err := c.IRBAC0Controller.CheckPermTx(db, domain, role, obj, act)
+	c.end(db.Statement.Context, call, valid, err)
+	return valid, enable, isAdmin, err
+}
+
+func (c *LoggedRBAC0Controller) CheckPermWithAttrs(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	valid, enable, isAdmin, err := c.IRBAC0Controller.CheckPermWithAttrs(ctx, domain, role, obj, act, attrs)
+	c.end(ctx, call, valid, err)
+	return valid, enable, isAdmin, err
+}
+
+func (c *LoggedRBAC0Controller) CheckPermWithAttrsTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act, attrs map[string]interface{}) (bool, bool, bool, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	valid, enable, isAdmin, err := c.IRBAC0Controller.CheckPermWithAttrsTx(db, domain, role, obj, act, attrs)
+	c.end(db.Statement.Context, call, valid, err)
+	return valid, enable, isAdmin, err
+}
+
+func (c *LoggedRBAC0Controller) CheckPerms(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(domain, roles, obj, act)
+	valid, err := c.IRBAC0Controller.CheckPerms(ctx, domain, roles, obj, act)
+	c.end(ctx, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) CheckPermsTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(domain, roles, obj, act)
+	valid, err := c.IRBAC0Controller.CheckPermsTx(db, domain, roles, obj, act)
+	c.end(db.Statement.Context, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) CheckUserPerm(ctx context.Context, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(domain, nil, obj, act)
+	call.r.User = user
+	valid, err := c.IRBAC0Controller.CheckUserPerm(ctx, domain, user, obj, act)
+	c.end(ctx, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) CheckUserPermTx(db *gorm.DB, domain perm.Domain, user int64, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(domain, nil, obj, act)
+	call.r.User = user
+	valid, err := c.IRBAC0Controller.CheckUserPermTx(db, domain, user, obj, act)
+	c.end(db.Statement.Context, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) CheckSessionPerm(ctx context.Context, session int64, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(perm.GlobalDomain, nil, obj, act)
+	call.r.Session = session
+	// 会话不存在时由检查返回错误
+	if s, err := c.IRBAC0Controller.GetSession(ctx, session); err == nil {
+		call.r.Domain = s.Domain
+	}
+	valid, err := c.IRBAC0Controller.CheckSessionPerm(ctx, session, obj, act)
+	c.end(ctx, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) CheckSessionPermTx(db *gorm.DB, session int64, obj perm.Obj, act perm.Act) (bool, error) {
+	call := c.begin(perm.GlobalDomain, nil, obj, act)
+	call.r.Session = session
+	if s, err := c.IRBAC0Controller.GetSessionTx(db, session); err == nil {
+		call.r.Domain = s.Domain
+	}
+	valid, err := c.IRBAC0Controller.CheckSessionPermTx(db, session, obj, act)
+	c.end(db.Statement.Context, call, valid, err)
+	return valid, err
+}
+
+func (c *LoggedRBAC0Controller) Decide(ctx context.Context, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	decision, err := c.IRBAC0Controller.Decide(ctx, domain, role, obj, act)
+	c.endDecision(ctx, call, decision, err)
+	return decision, err
+}
+
+func (c *LoggedRBAC0Controller) DecideTx(db *gorm.DB, domain perm.Domain, role perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	call := c.begin(domain, []perm.Role{role}, obj, act)
+	decision, err := c.IRBAC0Controller.DecideTx(db, domain, role, obj, act)
+	c.endDecision(db.Statement.Context, call, decision, err)
+	return decision, err
+}
+
+func (c *LoggedRBAC0Controller) DecideMany(ctx context.Context, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	call := c.begin(domain, roles, obj, act)
+	decision, err := c.IRBAC0Controller.DecideMany(ctx, domain, roles, obj, act)
+	c.endDecision(ctx, call, decision, err)
+	return decision, err
+}
+
+func (c *LoggedRBAC0Controller) DecideManyTx(db *gorm.DB, domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) (*perm.Decision, error) {
+	call := c.begin(domain, roles, obj, act)
+	decision, err := c.IRBAC0Controller.DecideManyTx(db, domain, roles, obj, act)
+	c.endDecision(db.Statement.Context, call, decision, err)
+	return decision, err
+}
+
+// --- internal method ---
+
+// rbac0DecisionCall 一次检查调用
+type rbac0DecisionCall struct {
+	r     *decisionlog.Record
+	start time.Time
+}
+
+func (c *LoggedRBAC0Controller) begin(domain perm.Domain, roles []perm.Role, obj perm.Obj, act perm.Act) *rbac0DecisionCall {
+	start := time.Now()
+	return &rbac0DecisionCall{
+		r: &decisionlog.Record{
+			Time:   start.UnixMilli(),
+			Domain: domain,
+			Roles:  roles,
+			Obj:    obj,
+			Act:    act,
+		},
+		start: start,
+	}
+}
+
+func (c *LoggedRBAC0Controller) end(ctx context.Context, call *rbac0DecisionCall, allowed bool, err error) {
+	call.r.Latency = time.Since(call.start)
+	call.r.Allowed = allowed && err == nil
+	if err != nil {
+		call.r.Error = err.Error()
+	}
+	c.l.Log(ctx, call.r)
+}
+
+func (c *LoggedRBAC0Controller) endDecision(ctx context.Context, call *rbac0DecisionCall, decision *perm.Decision, err error) {
+	if decision != nil {
+		call.r.Reason = decision.Reason.String()
+	}
+	c.end(ctx, call, decision != nil && decision.Allowed, err)
+}
@@ -0,0 +1,195 @@
+package access
+
+import (
+	"context"
+	"io"
+
+	"github.com/gromitlee/access/pkg/audit"
+	"github.com/gromitlee/access/pkg/errs"
+	"github.com/gromitlee/access/pkg/perm"
+	"github.com/gromitlee/access/pkg/policy"
+	"gorm.io/gorm"
+)
+
+// ExportRBAC0Policy 将ctl中的全部角色及其直接授予的权限按format写入w，见 policy.Policy
+func ExportRBAC0Policy(ctx context.Context, ctl IRBAC0Controller, w io.Writer, format policy.Format) error {
+	var p *policy.Policy
+	if err := ctl.Transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		p, err = loadRBAC0Policy(ctl, tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	return policy.Encode(w, p, format)
+}
+
+// ImportRBAC0Policy 从r按format读取 policy.Policy 并在一个事务中写入ctl，导入方式见 policy.ImportMode
+// 已有角色的域与admin标记不能通过导入修改；创建的角色记为ctx中的操作用户(见 audit.WithActor)创建
+func ImportRBAC0Policy(ctx context.Context, ctl IRBAC0Controller, r io.Reader, format policy.Format, mode policy.ImportMode) error {
+	p, err := policy.Decode(r, format)
+	if err != nil {
+		return err
+	}
+	return ctl.Transaction(ctx, func(tx *gorm.DB) error {
+		return importRBAC0Policy(ctl, tx, p, mode)
+	})
+}
+
+// PlanRBAC0Policy 比较ctl中的角色与权限和期望策略desired，生成使二者一致的 policy.Plan，不修改ctl
+// 可通过 policy.Plan.String 查看修改内容，opts.Protect为true时不删除desired中没有的角色
+func PlanRBAC0Policy(ctx context.Context, ctl IRBAC0Controller, desired *policy.Policy, opts policy.PlanOptions) (*policy.Plan, error) {
+	var plan *policy.Plan
+	if err := ctl.Transaction(ctx, func(tx *gorm.DB) error {
+		var err error
+		plan, err = planRBAC0Policy(ctl, tx, desired, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// ApplyRBAC0Plan 在一个事务中执行 PlanRBAC0Policy 生成的plan，任一修改失败时全部回滚
+// 生成plan后角色被修改时可能执行失败(例如要创建的角色已存在)，此时应重新生成plan
+func ApplyRBAC0Plan(ctx context.Context, ctl IRBAC0Controller, plan *policy.Plan) error {
+	return ctl.Transaction(ctx, func(tx *gorm.DB) error {
+		return applyRBAC0Plan(ctl, tx, plan)
+	})
+}
+
+// RBAC0ExportPolicy 单例模式的 ExportRBAC0Policy
+func RBAC0ExportPolicy(db *gorm.DB, w io.Writer, format policy.Format) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	var p *policy.Policy
+	if err := _rbac0Ctl.TransactionTx(db, func(tx *gorm.DB) error {
+		var err error
+		p, err = loadRBAC0Policy(_rbac0Ctl, tx)
+		return err
+	}); err != nil {
+		return err
+	}
+	return policy.Encode(w, p, format)
+}
+
+// RBAC0ImportPolicy 单例模式的 ImportRBAC0Policy
+func RBAC0ImportPolicy(db *gorm.DB, r io.Reader, format policy.Format, mode policy.ImportMode) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	p, err := policy.Decode(r, format)
+	if err != nil {
+		return err
+	}
+	return _rbac0Ctl.TransactionTx(db, func(tx *gorm.DB) error {
+		return importRBAC0Policy(_rbac0Ctl, tx, p, mode)
+	})
+}
+
+// RBAC0PlanPolicy 单例模式的 PlanRBAC0Policy
+func RBAC0PlanPolicy(db *gorm.DB, desired *policy.Policy, opts policy.PlanOptions) (*policy.Plan, error) {
+	if _rbac0Ctl == nil {
+		return nil, errs.ErrNotInitialized
+	}
+	var plan *policy.Plan
+	if err := _rbac0Ctl.TransactionTx(db, func(tx *gorm.DB) error {
+		var err error
+		plan, err = planRBAC0Policy(_rbac0Ctl, tx, desired, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// RBAC0ApplyPlan 单例模式的 ApplyRBAC0Plan
+func RBAC0ApplyPlan(db *gorm.DB, plan *policy.Plan) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	return _rbac0Ctl.TransactionTx(db, func(tx *gorm.DB) error {
+		return applyRBAC0Plan(_rbac0Ctl, tx, plan)
+	})
+}
+
+// --- internal function ---
+
+// loadRBAC0Policy 在tx中查询ctl的全部角色与直接授予的权限
+func loadRBAC0Policy(ctl IRBAC0Controller, tx *gorm.DB) (*policy.Policy, error) {
+	rolePerms, _, err := ctl.QueryRolePermsTx(tx, perm.RoleQuery{})
+	if err != nil {
+		return nil, err
+	}
+	return policy.FromRolePerms(rolePerms), nil
+}
+
+func importRBAC0Policy(ctl IRBAC0Controller, tx *gorm.DB, p *policy.Policy, mode policy.ImportMode) error {
+	if mode == policy.ImportReplace && len(p.Roles) == 0 {
+		return policy.ErrEmptyPolicy
+	}
+	plan, err := planRBAC0Policy(ctl, tx, p, mode.PlanOptions())
+	if err != nil {
+		return err
+	}
+	return applyRBAC0Plan(ctl, tx, plan)
+}
+
+func planRBAC0Policy(ctl IRBAC0Controller, tx *gorm.DB, desired *policy.Policy, opts policy.PlanOptions) (*policy.Plan, error) {
+	live, err := loadRBAC0Policy(ctl, tx)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Diff(live, desired, opts)
+}
+
+// applyRBAC0Plan 在tx中按顺序执行plan：创建角色、修改角色、删除角色
+func applyRBAC0Plan(ctl IRBAC0Controller, tx *gorm.DB, plan *policy.Plan) error {
+	for _, r := range plan.Create {
+		var perms []perm.Perm
+		if !r.IsAdmin {
+			perms = r.PermList()
+		}
+		creator := audit.ActorFromContext(tx.Statement.Context)
+		if _, err := ctl.CreateRoleTx(tx, r.Domain, r.ID, creator, r.Name, r.Desc, r.IsAdmin, perms...); err != nil {
+			return err
+		}
+		if !r.Enable {
+			if err := ctl.DisableRoleTx(tx, r.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range plan.Update {
+		if c.UpdateInfo {
+			if err := ctl.UpdateRoleTx(tx, c.ID, c.To.Name, c.To.Desc); err != nil {
+				return err
+			}
+		}
+		if c.UpdateEnable {
+			var err error
+			if c.To.Enable {
+				err = ctl.EnableRoleTx(tx, c.ID)
+			} else {
+				err = ctl.DisableRoleTx(tx, c.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := ctl.RevokeRolePermsTx(tx, c.ID, c.Revoke); err != nil {
+			return err
+		}
+		// 有效期不同的权限重复授予时更新有效期
+		if err := ctl.GrantRolePermsTx(tx, c.ID, c.Grant); err != nil {
+			return err
+		}
+	}
+	for _, r := range plan.Delete {
+		if err := ctl.DeleteRoleTx(tx, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package access
+
+import (
+	"context"
+	"time"
+
+	"github.com/gromitlee/access/pkg/errs"
+)
+
+// RunRBAC0PermSweeper 每隔interval调用一次ctl.SweepExpiredPerms清理已过期的权限，直到ctx结束
+// 清理出错时调用onError(可为nil)，不会中断清理；通常以goroutine方式运行
+func RunRBAC0PermSweeper(ctx context.Context, ctl IRBAC0Controller, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ctl.SweepExpiredPerms(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// RBAC0RunPermSweeper 单例模式的 RunRBAC0PermSweeper
+func RBAC0RunPermSweeper(ctx context.Context, interval time.Duration, onError func(error)) error {
+	if _rbac0Ctl == nil {
+		return errs.ErrNotInitialized
+	}
+	RunRBAC0PermSweeper(ctx, _rbac0Ctl, interval, onError)
+	return nil
+}